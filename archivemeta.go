@@ -0,0 +1,142 @@
+package logmanager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// metaSuffix is appended to an archive's name for its metadata file, when WriteArchiveMeta is set
+const metaSuffix = ".meta.json"
+
+// ArchiveMeta is the format of the <archive>.meta.json files written next to archives when WriteArchiveMeta is set
+type ArchiveMeta struct {
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	Lines          int       `json:"lines"`
+	Size           int64     `json:"size"`
+	CompressedSize int64     `json:"compressed_size"`
+}
+
+// lineTimeLayouts are the timestamp formats we look for at the start of a line
+var lineTimeLayouts = []string{"2006/01/02 15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// writeArchiveMeta is a helper function that describes the log at filename in the metadata file for archiveFn.
+// It's written to a temp file first, then renamed into place, so a crash never leaves a partial one behind.
+func (lm *LogManager) writeArchiveMeta(filename, archiveFn string) (err error) {
+	meta, err := lm.readArchiveMeta(filename)
+	if err != nil {
+		return
+	}
+
+	info, err := os.Stat(archiveFn)
+	if err != nil {
+		return
+	}
+	meta.CompressedSize = info.Size()
+
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+
+	path := archiveFn + metaSuffix
+	tmp, err := os.CreateTemp(filepath.Dir(path), lm.tempPattern(path))
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(b, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	return replaceFile(tmp.Name(), path)
+}
+
+// readArchiveMeta is a helper function that counts the lines and bytes in the log at filename, and works out the time it
+// covers from the timestamps on its first and last lines. If they don't have any, the file's times are used instead.
+func (lm *LogManager) readArchiveMeta(filename string) (meta ArchiveMeta, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var first, last []byte
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			meta.Lines++
+			meta.Size += int64(len(line))
+			if first == nil {
+				first = line
+			}
+			last = line
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return meta, err
+		}
+	}
+
+	start, okStart := parseLineTime(first)
+	end, okEnd := parseLineTime(last)
+	if okStart && okEnd {
+		meta.Start, meta.End = start, end
+		return
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	meta.Start, meta.End = info.ModTime(), info.ModTime()
+	if born, ok := lm.fs.BirthTime(info); ok {
+		meta.Start = born
+	}
+	return
+}
+
+// parseLineTime is a helper function that parses the timestamp at the start of a line, if it has one
+func parseLineTime(line []byte) (time.Time, bool) {
+	line = bytes.TrimPrefix(line, utf8BOM)
+
+	// RFC 3339 timestamps are usually followed by a space, but can be any length
+	if field := strings.SplitN(string(line), " ", 2)[0]; field != "" {
+		if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(field)); err == nil {
+			return t, true
+		}
+	}
+
+	for _, layout := range lineTimeLayouts {
+		if len(line) < len(layout) {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, string(line[:len(layout)]), time.Local); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// removeArchiveMeta is a helper function that removes the metadata file for the archive at path, if it has one
+func removeArchiveMeta(path string) error {
+	err := os.Remove(path + metaSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove archive metadata: %w", err)
+	}
+	return nil
+}
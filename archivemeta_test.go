@@ -0,0 +1,106 @@
+package logmanager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteArchiveMeta(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		GZIP:             true,
+		WriteArchiveMeta: true,
+		MaxBackups:       1,
+	})
+
+	input := "2022/05/17 12:00:00 first\n2022/05/17 12:30:00 second\n2022/05/17 13:00:00 third\n"
+	lm.Write([]byte(input))
+	old := lm.currentFile.Name()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := archiveName(old, CompressTarGz)
+	b, err := os.ReadFile(archive + metaSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta ArchiveMeta
+	err = json.Unmarshal(b, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ArchiveMeta{
+		Start:          time.Date(2022, 5, 17, 12, 0, 0, 0, time.Local),
+		End:            time.Date(2022, 5, 17, 13, 0, 0, 0, time.Local),
+		Lines:          3,
+		Size:           int64(len(input)),
+		CompressedSize: info.Size(),
+	}
+	if !meta.Start.Equal(want.Start) || !meta.End.Equal(want.End) || meta.Lines != want.Lines || meta.Size != want.Size || meta.CompressedSize != want.CompressedSize {
+		t.Errorf("Metadata is %+v, expected %+v", meta, want)
+	}
+
+	// Retention should take the metadata along with its archive
+	lm.Write([]byte("next\n"))
+	lm.Rotate()
+	lm.Write([]byte("next\n"))
+	lm.Rotate()
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Fatal("Archive wasn't removed by retention")
+	}
+	if _, err := os.Stat(archive + metaSuffix); !os.IsNotExist(err) {
+		t.Error("Archive metadata was left behind")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestArchiveMetaBirthTime(t *testing.T) {
+	born := time.Date(2022, 5, 17, 9, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		GZIP:             true,
+		WriteArchiveMeta: true,
+	})
+	lm.fs = &mockFS{reportBorn: true, born: born}
+
+	// Without any timestamps to go by, the log should start when the filesystem says it was created
+	lm.Write([]byte("no timestamp\n"))
+	old := lm.currentFile.Name()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(archiveName(old, CompressTarGz) + metaSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta ArchiveMeta
+	err = json.Unmarshal(b, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Start.Equal(born) {
+		t.Errorf("Metadata starts at %s, expected %s", meta.Start, born)
+	}
+
+	// Nothing should be left behind from writing it
+	matches, err := filepath.Glob(filepath.Join(lm.options.Dir, "*"+lm.options.TempSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Left behind %v", matches)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
@@ -0,0 +1,148 @@
+package logmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// ErrArchived is returned by WriteAt when the log for the given time has already been compressed
+var ErrArchived = errors.New("log has already been archived")
+
+// WriteAt writes p to the log that FilenameFormat renders for t, rather than the current one, for backfilling. It returns
+// ErrArchived if every log for t has already been compressed (or is being), since archives can't be appended to.
+func (lm *LogManager) WriteAt(t time.Time, p []byte) (n int, err error) {
+	n, err = lm.writeAtLocked(t, p)
+	if err != nil {
+		lm.drop(p[n:], err)
+	}
+	return
+}
+
+// writeAtLocked is a helper function that does the work of WriteAt, holding the lock for it
+func (lm *LogManager) writeAtLocked(t time.Time, p []byte) (n int, err error) {
+	err = lm.lockWrite()
+	if err != nil {
+		return
+	}
+	defer lm.Unlock()
+
+	if lm.options.FIFO || lm.options.ShiftMode {
+		return 0, errors.New("unable to write to a log by time with FIFO or ShiftMode")
+	}
+
+	// The current log takes writes for its own time as usual
+	base := lm.baseName(t)
+	if base == "" {
+		return 0, fmt.Errorf("unable to render the filename for %s", t)
+	}
+	if base == lm.currentBase && lm.currentFile != nil && !lm.pending {
+		size, err := lm.statCurrent()
+		if err != nil {
+			return 0, err
+		}
+		return lm.write(size, p)
+	}
+
+	name, fresh, err := lm.logAt(t)
+	if err != nil {
+		return
+	}
+	if lm.currentFile != nil && name == lm.currentFile.Name() {
+		return 0, fmt.Errorf("%s is the current log, but it was started at a different time", name)
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return 0, fmt.Errorf("unable to create log directory: %w", err)
+	}
+	f, err := lm.fs.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("unable to open log file: %w", err)
+	}
+
+	// Start brand new files the same way a rotation would
+	var start []byte
+	if fresh && lm.options.WriteBOM {
+		start = append(start, utf8BOM...)
+	}
+	if fresh {
+		start = append(start, lm.options.Header...)
+	}
+	_, err = f.Write(start)
+	if err != nil {
+		f.Close()
+		return 0, fmt.Errorf("unable to write header: %w", err)
+	}
+
+	n, err = f.Write(p)
+	atomic.AddUint64(&lm.stats.bytesWritten, uint64(n))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+
+	// Date it by what's in it, not when it was written, so it isn't mistaken for the newest log (e.g. by retention, or
+	// when picking up where we left off after a restart)
+	err = os.Chtimes(name, t, t)
+	if err != nil {
+		return n, fmt.Errorf("unable to set the backfilled log's modtime: %w", err)
+	}
+	return
+}
+
+// logAt is a helper function that finds the newest uncompressed log for t, or where to create the first one if there
+// aren't any. The lock must already be held.
+func (lm *LogManager) logAt(t time.Time) (name string, fresh bool, err error) {
+	lt := LogTemplate{Time: t, Iteration: lm.options.StartIteration}
+	var first, last, previous string
+	archived := false
+	for ; lt.Iteration <= lm.options.MaxIteration; lt.Iteration++ {
+		rendered := lm.render(&lt)
+		err = checkFilename(rendered)
+		if err != nil {
+			return
+		}
+		fn := filepath.Join(lm.options.Dir, rendered)
+
+		// Stop once the template doesn't depend on the iteration, or there aren't any more
+		if fn == previous {
+			break
+		}
+		previous = fn
+		if first == "" {
+			first = fn
+		}
+
+		// Originals that are being compressed, or waiting on DeleteDelay, are as good as archived already
+		if _, busy := lm.inFlight.Load(fn); busy {
+			archived = true
+			continue
+		}
+		if _, err := os.Stat(fn); err == nil {
+			last = fn
+			continue
+		}
+		used, err := lm.inUse(fn)
+		if err != nil {
+			return "", false, err
+		}
+		if !used {
+			break
+		}
+		archived = true
+	}
+
+	switch {
+	case last != "":
+		return last, false, nil
+	case archived:
+		return "", false, fmt.Errorf("unable to write to the log for %s: %w", t, ErrArchived)
+	}
+	return first, true, nil
+}
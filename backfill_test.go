@@ -0,0 +1,115 @@
+package logmanager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteAt(t *testing.T) {
+	now := time.Date(2022, 5, 17, 12, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		FilenameFormat: `{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log`,
+		Header:         "# app v1\n",
+		Now:            func() time.Time { return now },
+	})
+
+	// Backfilling the day before creates its log, header first
+	yesterday := now.AddDate(0, 0, -1)
+	for _, line := range []string{"a\n", "b\n"} {
+		_, err := lm.WriteAt(yesterday, []byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(lm.options.Dir, "2022-05-16_0.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "# app v1\na\nb\n" {
+		t.Errorf("Backfilled log contains %q", b)
+	}
+	if info, err := os.Stat(filepath.Join(lm.options.Dir, "2022-05-16_0.log")); err != nil || !info.ModTime().Equal(yesterday) {
+		t.Errorf("Backfilled log wasn't dated by its records")
+	}
+
+	// Today's records go to the current log as usual
+	_, err = lm.WriteAt(now, []byte("c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(lm.CurrentFilename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "# app v1\nc\n" {
+		t.Errorf("Current log contains %q", b)
+	}
+
+	// Backfilling carries on in the newest log for the day, past any that have been compressed
+	os.WriteFile(filepath.Join(lm.options.Dir, "2022-05-15_0.tar.gz"), nil, 0644)
+	os.WriteFile(filepath.Join(lm.options.Dir, "2022-05-15_1.log"), []byte("d\n"), 0644)
+	_, err = lm.WriteAt(now.AddDate(0, 0, -2), []byte("e\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(filepath.Join(lm.options.Dir, "2022-05-15_1.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "d\ne\n" {
+		t.Errorf("Backfilled log contains %q", b)
+	}
+
+	// A day that's only left in archives can't be written to
+	os.WriteFile(filepath.Join(lm.options.Dir, "2022-05-14_0.tar.gz"), nil, 0644)
+	_, err = lm.WriteAt(now.AddDate(0, 0, -3), []byte("f\n"))
+	if !errors.Is(err, ErrArchived) {
+		t.Errorf("Writing to an archived day returned %v, expected ErrArchived", err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestWriteAtInFlight(t *testing.T) {
+	for name, options := range map[string]LogManagerOptions{
+		"DeleteDelay":   {DeleteDelay: time.Hour},
+		"AsyncCompress": {AsyncCompress: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2022, 5, 17, 12, 0, 0, 0, time.Local)
+			options.FilenameFormat = `{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log`
+			options.GZIP = true
+			options.Now = func() time.Time { return now }
+			lm := setup(options)
+
+			// Hold up compressing yesterday's log, so it's still in flight
+			release := make(chan struct{})
+			lm.compressor = func(ctx context.Context, filename, dest string) error {
+				if options.AsyncCompress {
+					<-release
+				}
+				return lm.compress(ctx, filename, dest)
+			}
+			lm.Write([]byte("day1\n"))
+			now = now.AddDate(0, 0, 1)
+			err := lm.Rotate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The original might still be there, but anything written to it would never make it into the archive
+			_, err = lm.WriteAt(now.AddDate(0, 0, -1), []byte("backfilled\n"))
+			if !errors.Is(err, ErrArchived) {
+				t.Errorf("Writing to a log that's being archived returned %v, expected ErrArchived", err)
+			}
+
+			close(release)
+			lm.Close()
+			os.RemoveAll(lm.options.Dir)
+		})
+	}
+}
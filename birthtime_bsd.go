@@ -0,0 +1,19 @@
+//go:build darwin || freebsd || netbsd
+
+package logmanager
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// birthTime returns the time the file was created, if the platform keeps track of it
+func birthTime(info os.FileInfo) (time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(stat.Birthtimespec.Unix()), true
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !freebsd && !netbsd && !windows
+
+package logmanager
+
+import (
+	"os"
+	"time"
+)
+
+// birthTime returns the time the file was created, if the platform keeps track of it
+func birthTime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
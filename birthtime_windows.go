@@ -0,0 +1,19 @@
+//go:build windows
+
+package logmanager
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// birthTime returns the time the file was created, if the platform keeps track of it
+func birthTime(info os.FileInfo) (time.Time, bool) {
+	attr, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, attr.CreationTime.Nanoseconds()), true
+}
@@ -0,0 +1,121 @@
+package logmanager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Compact trims the current log down to its last keepBytes (from the start of a line), without rotating it. The header
+// (and BOM) are kept.
+func (lm *LogManager) Compact(keepBytes int64) (err error) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	err = lm.createPending()
+	if err != nil {
+		return
+	}
+	if lm.currentFile == nil || lm.closed {
+		return os.ErrClosed
+	}
+	if lm.options.FIFO {
+		return errors.New("unable to compact a FIFO")
+	}
+	if lm.streaming() {
+		return errors.New("unable to compact a compressed stream")
+	}
+	err = lm.wake()
+	if err != nil {
+		return
+	}
+
+	// Check if there's anything to trim
+	var start []byte
+	if lm.options.WriteBOM {
+		start = append(start, utf8BOM...)
+	}
+	start = append(start, lm.options.Header...)
+	size, err := lm.statCurrent()
+	if err != nil {
+		return
+	}
+	if keepBytes < 0 {
+		keepBytes = 0
+	}
+	if size-int64(len(start)) <= keepBytes {
+		return nil
+	}
+
+	// Read what we're keeping, along with the byte before it, to tell if it starts on a line
+	name := lm.currentFile.Name()
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("unable to open log file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat log file: %w", err)
+	}
+	tail := make([]byte, keepBytes+1)
+	_, err = f.ReadAt(tail, size-keepBytes-1)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("unable to read log file: %w", err)
+	}
+	if tail[0] == '\n' {
+		tail = tail[1:]
+	} else if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	} else {
+		tail = nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), lm.tempPattern(name))
+	if err != nil {
+		return fmt.Errorf("unable to create compacted log file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(start, tail...))
+	if err == nil {
+		err = tmp.Chmod(info.Mode())
+	}
+	if err == nil && lm.options.SyncDir {
+		err = lm.fs.Sync(tmp)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write compacted log file: %w", err)
+	}
+
+	// Swap it in, then carry on writing to it
+	// The old one has to be closed first, since Windows won't replace a file that's open
+	err = lm.currentFile.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close log file: %w", err)
+	}
+	replaceErr := replaceFile(tmp.Name(), name)
+	reopened, err := lm.fs.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		// Treat it like an idle file, so the next write tries to reopen it again
+		lm.idle = true
+		return fmt.Errorf("unable to reopen log file: %w", err)
+	}
+	lm.currentFile = reopened
+	if replaceErr != nil {
+		return fmt.Errorf("unable to replace log file: %w", replaceErr)
+	}
+
+	lm.overhead = int64(len(start))
+	atomic.StoreInt64(&lm.stats.currentFileSize, int64(len(start)+len(tail)))
+	lm.rotateFollowers()
+
+	// Links and copies of the old file don't follow it being replaced
+	return lm.setSymlink()
+}
@@ -0,0 +1,92 @@
+package logmanager
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	lm := setup(LogManagerOptions{Header: "# app v1\n"})
+	for i := 0; i < 100; i++ {
+		lm.Write([]byte(fmt.Sprintf("line %02d\n", i)))
+	}
+
+	// Lines are 8 bytes, so this should land part way through one, which shouldn't be kept
+	err := lm.Compact(36)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = lm.Write([]byte("after\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(lm.CurrentFilename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# app v1\nline 96\nline 97\nline 98\nline 99\nafter\n"
+	if string(b) != want {
+		t.Errorf("Compacted log contains %q, expected %q", b, want)
+	}
+	if size := lm.Stats().CurrentFileSize; size != int64(len(want)) {
+		t.Errorf("Current file size is %d after compacting, expected %d", size, len(want))
+	}
+
+	// Compacting to more than there is shouldn't change anything
+	err = lm.Compact(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(lm.CurrentFilename())
+	if string(b) != want {
+		t.Errorf("Log contains %q after compacting to more than its size, expected %q", b, want)
+	}
+
+	// Nothing else should be left in the directory
+	entries, _ := os.ReadDir(lm.options.Dir)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("Compacting left %s behind", entry.Name())
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestCompactWhileWriting(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+
+	// Compact over and over while writing, every line that's left should still be whole
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			lm.Write([]byte(fmt.Sprintf("line %04d\n", i)))
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		err := lm.Compact(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	b, err := os.ReadFile(lm.CurrentFilename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		if len(line) != len("line 0000") || !strings.HasPrefix(line, "line ") {
+			t.Errorf("Compacting while writing left %q in the log", line)
+		}
+	}
+	if !strings.HasSuffix(string(b), "line 0999\n") {
+		t.Error("Writes after compacting were lost")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
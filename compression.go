@@ -0,0 +1,163 @@
+package logmanager
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CompressionFormat controls what kind of archive old logs are compressed into
+type CompressionFormat int
+
+const (
+	// CompressTarGz compresses old logs into .tar.gz archives (default)
+	CompressTarGz CompressionFormat = iota
+	// CompressZip compresses old logs into .zip archives, which are easier to open on Windows
+	CompressZip
+	// CompressGzip gzips old logs on their own into .gz files, without a tar archive around them.
+	// Bundles still need to hold more than one file, so they're always .tar.gz.
+	CompressGzip
+)
+
+// DefaultCopyBufferSize is the size of the buffer used to copy logs into archives when CopyBufferSize isn't set
+const DefaultCopyBufferSize = 32 * 1024
+
+// copyBuffers holds copy buffers between compressions, so that frequent rotations don't allocate a new one every time
+var copyBuffers sync.Pool
+
+// getCopyBuffer is a helper function that returns a copy buffer of the given size, from the pool if there's one big enough
+func getCopyBuffer(size int) *[]byte {
+	if size <= 0 {
+		size = DefaultCopyBufferSize
+	}
+	if buf, ok := copyBuffers.Get().(*[]byte); ok && cap(*buf) >= size {
+		*buf = (*buf)[:size]
+		return buf
+	}
+	buf := make([]byte, size)
+	return &buf
+}
+
+// copyFile is a helper function that copies file to w through buf
+func copyFile(w io.Writer, file *os.File, buf []byte) error {
+	// Hide the file's WriteTo, otherwise io.CopyBuffer would hand off to it, and it'd allocate its own buffer anyway
+	_, err := io.CopyBuffer(w, struct{ io.Reader }{file}, buf)
+	return err
+}
+
+// contextWriter is a writer that stops accepting writes once its context is done
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// Write writes p, unless the context is done
+func (cw contextWriter) Write(p []byte) (int, error) {
+	err := cw.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// archiveExts are the extensions of every archive format we might have written
+var archiveExts = []string{".tar.gz", ".zip", ".gz"}
+
+// ext returns the extension of archives in this format
+func (f CompressionFormat) ext() string {
+	switch f {
+	case CompressZip:
+		return ".zip"
+	case CompressGzip:
+		return ".gz"
+	}
+	return ".tar.gz"
+}
+
+// isArchive is a helper function that checks if filename is an archive we wrote, in any format
+func isArchive(filename string) bool {
+	return archiveExt(filename) != ""
+}
+
+// archiveExt is a helper function that returns the archive extension of filename, or "" if it isn't an archive
+func archiveExt(filename string) string {
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(filename, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// writeGzip is a helper function to gzip a single file, recording its name and modtime (and comment, if any) in the gzip header
+func writeGzip(w io.Writer, buf []byte, filename, comment string) (err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	gw.Name = filepath.Base(filename)
+	gw.ModTime = info.ModTime()
+	gw.Comment = comment
+
+	err = copyFile(gw, file, buf)
+	if err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// writeZip is a helper function to write one or more files into a zip archive
+func writeZip(w io.Writer, buf []byte, filenames ...string) (err error) {
+	zw := zip.NewWriter(w)
+	for _, filename := range filenames {
+		err = addToZip(zw, filename, buf)
+		if err != nil {
+			return
+		}
+	}
+
+	return zw.Close()
+}
+
+// addToZip is a helper function to write a single file into a zip archive
+func addToZip(zw *zip.Writer, filename string, buf []byte) (err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+
+	// Only use the basename, so the archive extracts next to itself when opened
+	header.Name = filepath.Base(filename)
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	return copyFile(w, file, buf)
+}
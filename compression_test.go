@@ -0,0 +1,505 @@
+package logmanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompressZip(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		GZIP:              true,
+		CompressionFormat: CompressZip,
+	})
+
+	lm.Write([]byte("zipped"))
+	old := lm.currentFile.Name()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check if old log file was replaced by a zip
+	_, err = os.Stat(old)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Error("Old log file was not deleted")
+	}
+	zr, err := zip.OpenReader(strings.TrimSuffix(old, ".log") + ".zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	// Check that it extracts to the original log
+	if len(zr.File) != 1 || zr.File[0].Name != filepath.Base(old) {
+		t.Fatalf("Unexpected zip contents %v", zr.File)
+	}
+	f, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "zipped" {
+		t.Errorf("Zip contains %q, expected %q", b, "zipped")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+// tarEntryNames is a helper function that lists the names of the entries in a .tar.gz archive
+func tarEntryNames(t *testing.T, path string) (names []string) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+}
+
+func TestTarEntryName(t *testing.T) {
+	// By default, entries are named after the log, so the archive extracts next to itself
+	lm := setup(LogManagerOptions{GZIP: true})
+	lm.Write([]byte("test"))
+	old := lm.currentFile.Name()
+	lm.Rotate()
+	if names := tarEntryNames(t, strings.TrimSuffix(old, ".log")+".tar.gz"); len(names) != 1 || names[0] != filepath.Base(old) {
+		t.Errorf("Archive contains %v, expected only %s", names, filepath.Base(old))
+	}
+	os.RemoveAll(lm.options.Dir)
+
+	lm = setup(LogManagerOptions{
+		GZIP: true,
+		TarEntryNameFunc: func(logPath string) string {
+			return "logs/2022-05-17/" + filepath.Base(logPath)
+		},
+	})
+	lm.Write([]byte("test"))
+	old = lm.currentFile.Name()
+	lm.Rotate()
+	want := "logs/2022-05-17/" + filepath.Base(old)
+	if names := tarEntryNames(t, strings.TrimSuffix(old, ".log")+".tar.gz"); len(names) != 1 || names[0] != want {
+		t.Errorf("Archive contains %v, expected only %s", names, want)
+	}
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestCompressGzip(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		GZIP:              true,
+		CompressionFormat: CompressGzip,
+		GZIPComment:       "host=test",
+	})
+
+	lm.Write([]byte("gzipped"))
+	old := lm.currentFile.Name()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(strings.TrimSuffix(old, ".log") + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gr.Name != filepath.Base(old) || gr.Comment != "host=test" {
+		t.Errorf("Gzip header has name %q and comment %q", gr.Name, gr.Comment)
+	}
+	b, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "gzipped" {
+		t.Errorf("Gzip contains %q, expected %q", b, "gzipped")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+// xorCipher is a stand-in for a real cipher, that XORs everything with key
+type xorCipher struct {
+	key byte
+	w   io.Writer
+	r   io.Reader
+}
+
+func (x *xorCipher) Write(p []byte) (int, error) {
+	out := make([]byte, len(p))
+	for i := range p {
+		out[i] = p[i] ^ x.key
+	}
+	return x.w.Write(out)
+}
+
+func (x *xorCipher) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= x.key
+	}
+	return n, err
+}
+
+func (x *xorCipher) Close() error {
+	return nil
+}
+
+func TestArchivePipe(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		GZIP:              true,
+		CompressionFormat: CompressGzip,
+		ArchivePipe:       func(w io.Writer) io.WriteCloser { return &xorCipher{key: 0x5A, w: w} },
+	})
+
+	lm.Write([]byte("secret"))
+	old := lm.currentFile.Name()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The archive on disk shouldn't be a gzip file anymore
+	f, err := os.Open(strings.TrimSuffix(old, ".log") + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := gzip.NewReader(f); err == nil {
+		t.Error("Archive wasn't passed through the pipe")
+	}
+
+	// But it should be once it's been deciphered
+	f.Seek(0, io.SeekStart)
+	gr, err := gzip.NewReader(&xorCipher{key: 0x5A, r: f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "secret" {
+		t.Errorf("Archive contains %q, expected %q", b, "secret")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestAppendArchiveExt(t *testing.T) {
+	for _, test := range []struct {
+		append bool
+		format CompressionFormat
+		want   string
+	}{
+		{false, CompressGzip, "app.gz"},
+		{true, CompressGzip, "app.log.gz"},
+		{false, CompressTarGz, "app.tar.gz"},
+		{true, CompressTarGz, "app.log.tar.gz"},
+	} {
+		lm := setup(LogManagerOptions{
+			FilenameFormat:    "app.log",
+			GZIP:              true,
+			CompressionFormat: test.format,
+			AppendArchiveExt:  test.append,
+		})
+		lm.Write([]byte("line\n"))
+
+		// Rotate to a different name, so app.log is archived as-is
+		err := lm.Reconfigure(LogManagerOptions{
+			FilenameFormat:    "next.log",
+			GZIP:              true,
+			CompressionFormat: test.format,
+			AppendArchiveExt:  test.append,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(filepath.Join(lm.options.Dir, test.want)); err != nil {
+			t.Errorf("Archive wasn't named %s: %s", test.want, err)
+		}
+
+		os.RemoveAll(lm.options.Dir)
+	}
+}
+
+func TestUploadArchive(t *testing.T) {
+	uploads := map[string][]byte{}
+	var mu sync.Mutex
+	lm := setup(LogManagerOptions{
+		FilenameFormat:    "{{ .Iteration }}.log",
+		GZIP:              true,
+		CompressionFormat: CompressGzip,
+		DeleteAfterUpload: true,
+		UploadArchive: func(ctx context.Context, name string, r io.Reader) error {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if name == "1.gz" {
+				return errors.New("remote is down")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			uploads[name] = b
+			return nil
+		},
+	})
+
+	lm.Write([]byte("uploaded\n"))
+	lm.Rotate()
+	lm.Write([]byte("kept\n"))
+	lm.Rotate()
+
+	// Closing waits for the uploads to finish
+	lm.Close()
+	r, err := gzip.NewReader(bytes.NewReader(uploads["0.gz"]))
+	if err != nil {
+		t.Fatalf("Uploaded archive isn't a gzip file: %s", err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "uploaded\n" {
+		t.Errorf("Uploaded archive contains %q, expected the rotated log", b)
+	}
+
+	if _, err := os.Stat(filepath.Join(lm.options.Dir, "0.gz")); !os.IsNotExist(err) {
+		t.Error("Uploaded archive wasn't deleted")
+	}
+	if _, err := os.Stat(filepath.Join(lm.options.Dir, "1.gz")); err != nil {
+		t.Errorf("Archive that failed to upload wasn't kept: %s", err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+// cancellingWriter is an ArchivePipe that cancels its context on every write
+type cancellingWriter struct {
+	w      io.Writer
+	cancel context.CancelFunc
+	closed bool
+}
+
+func (c *cancellingWriter) Write(p []byte) (int, error) {
+	c.cancel()
+	return c.w.Write(p)
+}
+
+func (c *cancellingWriter) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRotateContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var pipe *cancellingWriter
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "{{ .Iteration }}.log",
+		GZIP:           true,
+		// Cancel as soon as the archive starts being written
+		ArchivePipe: func(w io.Writer) io.WriteCloser {
+			pipe = &cancellingWriter{w: w, cancel: cancel}
+			return pipe
+		},
+	})
+
+	// Enough that compressing it takes more than a single write
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	lm.Write(data)
+	old := lm.CurrentFilename()
+
+	err := lm.RotateContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Cancelled rotation returned %v, expected context.Canceled", err)
+	}
+	if !pipe.closed {
+		t.Error("Archive pipe wasn't closed after the compression was cancelled")
+	}
+
+	// The old log should be left as it was, with nothing else next to it but the new log
+	b, err := os.ReadFile(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Old log was changed by the cancelled compression")
+	}
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if name := filepath.Join(lm.options.Dir, entry.Name()); name != old && name != lm.CurrentFilename() {
+			t.Errorf("Cancelled compression left %s behind", entry.Name())
+		}
+	}
+	_, err = lm.Write([]byte("carried on\n"))
+	if err != nil {
+		t.Errorf("Couldn't write after a cancelled rotation: %s", err)
+	}
+
+	// It shouldn't even start with a context that's already done
+	err = lm.RotateContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Rotating with a cancelled context returned %v, expected context.Canceled", err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestDeleteDelay(t *testing.T) {
+	lm := setup(LogManagerOptions{GZIP: true, DeleteDelay: 100 * time.Millisecond})
+	lm.Write([]byte("line\n"))
+	old := lm.CurrentFilename()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The original should outlive its archive being written, for a while
+	if _, err := os.Stat(old); err != nil {
+		t.Fatalf("Original was removed straight away: %s", err)
+	}
+	if _, err := os.Stat(lm.archivePath(old)); err != nil {
+		t.Fatalf("Archive wasn't written: %s", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(old); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Original wasn't removed after the delay")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Closing shouldn't wait out the delay, but it should still clean up
+	lm.Reconfigure(LogManagerOptions{GZIP: true, DeleteDelay: time.Hour})
+	lm.Write([]byte("line\n"))
+	old = lm.CurrentFilename()
+	lm.Rotate()
+	closed := make(chan struct{})
+	go func() {
+		lm.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close waited for the delete delay")
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("Original wasn't removed on Close")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestDeleteDelayRetention(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat:    "{{ .Iteration }}.log",
+		GZIP:              true,
+		CompressionFormat: CompressGzip,
+		DeleteDelay:       time.Hour,
+		MaxBackups:        2,
+	})
+
+	for i := 0; i < 4; i++ {
+		lm.Write([]byte("line\n"))
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Originals waiting to be removed shouldn't push out the archives that replace them
+	for _, name := range []string{"2.gz", "3.gz"} {
+		if _, err := os.Stat(filepath.Join(lm.options.Dir, name)); err != nil {
+			t.Errorf("Archive %s didn't survive retention: %s", name, err)
+		}
+	}
+	for _, name := range []string{"0.gz", "1.gz"} {
+		if _, err := os.Stat(filepath.Join(lm.options.Dir, name)); !os.IsNotExist(err) {
+			t.Errorf("Archive %s should've been removed by retention", name)
+		}
+	}
+
+	lm.Close()
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestArchivePathFor(t *testing.T) {
+	lm := setup(LogManagerOptions{FilenameFormat: "{{ .Iteration }}.log", GZIP: true})
+	archiveDir := filepath.Join(lm.options.Dir, "archive")
+	lm.Reconfigure(LogManagerOptions{FilenameFormat: "{{ .Iteration }}.log", GZIP: true, ArchiveDir: archiveDir})
+
+	// The archive's name should be known before it's compressed, and be where it ends up
+	want := filepath.Join(archiveDir, "0.tar.gz")
+	for _, path := range []string{"0.log", lm.CurrentFilename()} {
+		if got := lm.ArchivePathFor(path); got != want {
+			t.Errorf("Archive path for %s is %s, expected %s", path, got, want)
+		}
+	}
+	lm.Write([]byte("line\n"))
+	old := lm.CurrentFilename()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("Archive isn't at its expected path: %s", err)
+	}
+
+	// Compressing the same log again should land on the same path, whenever it's done
+	os.WriteFile(old, []byte("line\n"), 0644)
+	err = lm.compress(context.Background(), old, lm.ArchivePathFor(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(archiveDir)
+	if len(entries) != 1 || entries[0].Name() != "0.tar.gz" {
+		t.Errorf("Compressing again left %d archives, expected just 0.tar.gz", len(entries))
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
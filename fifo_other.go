@@ -0,0 +1,18 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package logmanager
+
+import (
+	"errors"
+	"os"
+)
+
+// openFIFO opens the named pipe at name for writing, without blocking if it doesn't have a reader yet
+func openFIFO(name string) (*os.File, error) {
+	return nil, errors.New("FIFOs are not supported on this platform")
+}
+
+// isBrokenPipe reports whether err is from writing to a pipe with no reader
+func isBrokenPipe(err error) bool {
+	return false
+}
@@ -0,0 +1,25 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package logmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openFIFO opens the named pipe at name for writing, without blocking if it doesn't have a reader yet
+func openFIFO(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, syscall.ENXIO) {
+		return nil, fmt.Errorf("no reader for %s", name)
+	}
+
+	return f, err
+}
+
+// isBrokenPipe reports whether err is from writing to a pipe with no reader
+func isBrokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,80 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package logmanager
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFIFO(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipe := filepath.Join(dir, "app.pipe")
+	err = syscall.Mkfifo(pipe, 0644)
+	if err != nil {
+		t.Skip("Platform doesn't support mkfifo:", err)
+	}
+
+	// Without a reader, writes should fail rather than block
+	lm := NewLogManager(LogManagerOptions{
+		Dir:            dir,
+		FilenameFormat: "app.pipe",
+		FIFO:           true,
+		MaxFileSize:    1,
+	})
+	_, err = lm.Write([]byte("dropped"))
+	if err == nil {
+		t.Error("Write without a reader did not fail")
+	}
+
+	// Once there's a reader, the pipe should get opened on the next write
+	r, err := os.OpenFile(pipe, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, s := range []string{"test1", "test2"} {
+		_, err = lm.Write([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A manual rotation just reopens the pipe
+	err = lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = lm.Write([]byte("test3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lm.CurrentFilename() != pipe {
+		t.Errorf("Rotated to %s instead of reopening the pipe", lm.CurrentFilename())
+	}
+
+	// Check that everything arrived, in order
+	r.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 15)
+	n := 0
+	for n < len(b) {
+		m, err := r.Read(b[n:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += m
+	}
+	if string(b) != "test1test2test3" {
+		t.Errorf("Reader got %q", b)
+	}
+
+	lm.Close()
+	os.RemoveAll(dir)
+}
@@ -0,0 +1,206 @@
+package logmanager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// filenamePattern matches the names FilenameFormat renders, to get the time and iteration back out of them.
+// Only templates made of text, {{ .Time.Format "..." }}, and {{ .Iteration }} are supported.
+type filenamePattern struct {
+	re        *regexp.Regexp
+	layouts   []string // The time layout for each time group, in order
+	groups    []bool   // Whether each group is a time (or the iteration)
+	extension string   // The extension of rendered names, for matching archives that replaced it
+}
+
+// ErrUnsupportedFormat is returned by ParseFilename when FilenameFormat does more than can be undone
+var ErrUnsupportedFormat = errors.New("filename format can't be parsed back into a time")
+
+// ParseFilename gets the time and iteration back out of the name of a log, or any of its archives. Formats with actions
+// other than {{ .Time.Format "..." }} and {{ .Iteration }} return ErrUnsupportedFormat.
+func (lm *LogManager) ParseFilename(name string) (time.Time, uint, error) {
+	lm.Lock()
+	pattern, err := compileFilenamePattern(lm.templater)
+	lm.Unlock()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	t, iteration, ok := pattern.parse(name)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("%s doesn't match the filename format", name)
+	}
+	return t, iteration, nil
+}
+
+// compileFilenamePattern is a helper function that turns the filename template into a pattern that matches its output
+func compileFilenamePattern(tmpl *template.Template) (*filenamePattern, error) {
+	if tmpl == nil || tmpl.Tree == nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	p := &filenamePattern{}
+	var expr strings.Builder
+	var text string
+	for _, node := range tmpl.Tree.Root.Nodes {
+		switch node := node.(type) {
+		case *parse.TextNode:
+			expr.WriteString(regexp.QuoteMeta(string(node.Text)))
+			text += string(node.Text)
+		case *parse.ActionNode:
+			if len(node.Pipe.Decl) != 0 || len(node.Pipe.Cmds) != 1 {
+				return nil, ErrUnsupportedFormat
+			}
+			args := node.Pipe.Cmds[0].Args
+			field, ok := args[0].(*parse.FieldNode)
+			if !ok {
+				return nil, ErrUnsupportedFormat
+			}
+			switch {
+			case len(args) == 1 && len(field.Ident) == 1 && field.Ident[0] == "Iteration":
+				expr.WriteString(`(\d+)`)
+				p.groups = append(p.groups, false)
+			case len(args) == 2 && len(field.Ident) == 2 && field.Ident[0] == "Time" && field.Ident[1] == "Format":
+				layout, ok := args[1].(*parse.StringNode)
+				if !ok {
+					return nil, ErrUnsupportedFormat
+				}
+				// Times don't cross directories, unless their layout does
+				expr.WriteString(`(` + strings.Repeat(`[^/]+?/`, strings.Count(layout.Text, "/")) + `[^/]+?)`)
+				p.groups = append(p.groups, true)
+				p.layouts = append(p.layouts, layout.Text)
+			default:
+				return nil, ErrUnsupportedFormat
+			}
+			text = ""
+		default:
+			return nil, ErrUnsupportedFormat
+		}
+	}
+	if len(p.layouts) == 0 {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// The extension only counts if it comes after everything that's rendered
+	if !strings.Contains(text, "/") {
+		p.extension = filepath.Ext(text)
+	}
+
+	// Logs can be moved into subdirectories (partitions, or ArchiveDir), so only the end of their path has to match
+	re, err := regexp.Compile(`(?:^|/)` + expr.String() + `$`)
+	if err != nil {
+		return nil, err
+	}
+	p.re = re
+	return p, nil
+}
+
+// parse is a helper function that gets the time and iteration back out of the path of a log, or any of its archives
+func (p *filenamePattern) parse(path string) (t time.Time, iteration uint, ok bool) {
+	path = filepath.ToSlash(path)
+
+	// Archives either have their extension replacing the log's, or tacked on after it
+	candidates := []string{path}
+	if ext := archiveExt(path); ext != "" {
+		trimmed := strings.TrimSuffix(path, ext)
+		candidates = []string{trimmed, trimmed + p.extension}
+	}
+
+	for _, candidate := range candidates {
+		m := p.re.FindStringSubmatch(candidate)
+		if m == nil {
+			continue
+		}
+
+		var values []string
+		iteration = 0
+		for i, isTime := range p.groups {
+			if isTime {
+				values = append(values, m[i+1])
+				continue
+			}
+			n, err := strconv.ParseUint(m[i+1], 10, 0)
+			if err == nil {
+				iteration = uint(n)
+			}
+		}
+
+		// Parse every time in the name at once, so each can fill in what the others leave out
+		t, err := time.ParseInLocation(strings.Join(p.layouts, "\x00"), strings.Join(values, "\x00"), time.Local)
+		if err == nil {
+			return t, iteration, true
+		}
+	}
+
+	return time.Time{}, 0, false
+}
+
+// logNames is a helper function that compiles a pattern for the paths of every log the log manager could have named,
+// including archives and bundles. It returns nil, which matches everything, if there's no telling what they look like.
+func (lm *LogManager) logNames() *regexp.Regexp {
+	if lm.templater == nil || lm.templater.Tree == nil || lm.options.CollisionResolver != nil {
+		return nil
+	}
+
+	var expr strings.Builder
+	var text string
+	for _, node := range lm.templater.Tree.Root.Nodes {
+		switch node := node.(type) {
+		case *parse.TextNode:
+			expr.WriteString(regexp.QuoteMeta(string(node.Text)))
+			text += string(node.Text)
+		case *parse.ActionNode:
+			expr.WriteString(actionPattern(node))
+			text = ""
+		default:
+			return nil
+		}
+	}
+
+	// Archives either have their extension replacing the log's, or tacked on after it
+	stem := expr.String()
+	var ext string
+	if !strings.Contains(text, "/") && filepath.Ext(text) != "" {
+		ext = regexp.QuoteMeta(filepath.Ext(text))
+		stem = strings.TrimSuffix(stem, ext)
+	}
+	var archives []string
+	for _, a := range archiveExts {
+		archives = append(archives, regexp.QuoteMeta(a))
+	}
+
+	re, err := regexp.Compile(`(?:^|/)(?:` + stem + `(?:` + ext + `)?(?:\.\d+)?(?:` + strings.Join(archives, "|") + `)?|bundle-[^/]+)$`)
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// actionPattern is a helper function that returns the pattern for what an action in the filename template renders
+func actionPattern(node *parse.ActionNode) string {
+	if len(node.Pipe.Decl) != 0 || len(node.Pipe.Cmds) != 1 {
+		return `.*?`
+	}
+	args := node.Pipe.Cmds[0].Args
+	field, ok := args[0].(*parse.FieldNode)
+	if !ok {
+		return `.*?`
+	}
+	switch {
+	case len(args) == 1 && len(field.Ident) == 1 && field.Ident[0] == "Iteration":
+		return `\d+`
+	case len(args) == 2 && len(field.Ident) == 2 && field.Ident[0] == "Time" && field.Ident[1] == "Format":
+		if layout, ok := args[1].(*parse.StringNode); ok {
+			return strings.Repeat(`[^/]+?/`, strings.Count(layout.Text, "/")) + `[^/]+?`
+		}
+	}
+	return `.*?`
+}
@@ -0,0 +1,77 @@
+package logmanager
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestFilenamePattern(t *testing.T) {
+	day := time.Date(2022, 5, 17, 0, 0, 0, 0, time.Local)
+	for _, test := range []struct {
+		format    string
+		path      string
+		time      time.Time
+		iteration uint
+		ok        bool
+	}{
+		{`{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log`, "/logs/2022-05-17_3.log", day, 3, true},
+		{`{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log`, "/logs/2022-05-17_3.tar.gz", day, 3, true},
+		{`{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log`, "/logs/2022-05-17_3.log.gz", day, 3, true},
+		{`{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log`, "/logs/2022/05/17/2022-05-17_3.log", day, 3, true},
+		{`{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log`, "/logs/other.log", time.Time{}, 0, false},
+		{`{{ .Time.Format "2006/01" }}/{{ .Time.Format "02" }}.log`, "/logs/2022/05/17.log", day, 0, true},
+		{`app-{{ .Time.Format "2006-01-02T15" }}.log`, "/logs/app-2022-05-17T10.log", day.Add(10 * time.Hour), 0, true},
+	} {
+		pattern, err := compileFilenamePattern(template.Must(template.New("").Parse(test.format)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tm, iteration, ok := pattern.parse(test.path)
+		if ok != test.ok || !tm.Equal(test.time) || iteration != test.iteration {
+			t.Errorf("Parsed %s with %s as %s, %d, %t, expected %s, %d, %t", test.path, test.format, tm, iteration, ok, test.time, test.iteration, test.ok)
+		}
+	}
+
+	// Anything more complicated can't be undone
+	for _, format := range []string{"{{ .Iteration }}.log", `{{ .Time.Year }}.log`, `{{ if .Iteration }}{{ .Iteration }}{{ end }}.log`} {
+		_, err := compileFilenamePattern(template.Must(template.New("").Parse(format)))
+		if err == nil {
+			t.Errorf("%s compiled into a pattern", format)
+		}
+	}
+}
+
+func TestParseFilename(t *testing.T) {
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		FilenameFormat: `{{ .Time.Format "2006-01-02T15" }}_{{ .Iteration }}.log`,
+		Now:            func() time.Time { return now },
+	})
+
+	// Round trip the name the manager rendered, as well as those of later iterations and archives
+	for name, want := range map[string]uint{lm.CurrentFilename(): 0, "2022-05-17T10_3.log.gz": 3, "2022-05-17T10_4.tar.gz": 4} {
+		tm, iteration, err := lm.ParseFilename(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tm.Equal(now) || iteration != want {
+			t.Errorf("Parsed %s as %s, %d, expected %s, %d", name, tm, iteration, now, want)
+		}
+	}
+
+	_, _, err := lm.ParseFilename("other.log")
+	if err == nil {
+		t.Error("Parsed a name the filename format couldn't have rendered")
+	}
+	os.RemoveAll(lm.options.Dir)
+
+	lm = setup(LogManagerOptions{FilenameFormat: "{{ .Iteration }}.log"})
+	_, _, err = lm.ParseFilename("0.log")
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Parsing without a time in the format returned %v, expected ErrUnsupportedFormat", err)
+	}
+	os.RemoveAll(lm.options.Dir)
+}
@@ -0,0 +1,185 @@
+package logmanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// follower is a reader tailing the log through rotations, for Follow
+type follower struct {
+	mu   sync.Mutex
+	next []*os.File    // Logs rotated to since the current one, oldest first, opened where their writes start
+	done bool          // Set once the log manager is closed, so there's nothing left to wait for
+	wake chan struct{} // Signalled whenever there's something new to read
+}
+
+// signal is a helper function that wakes the follower up, without waiting if it's already been woken
+func (f *follower) signal() {
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Follow streams each line written to the log from now on (without its newline), like tail -f, across rotations. The
+// channel is closed once ctx is done, or the log manager is closed.
+func (lm *LogManager) Follow(ctx context.Context) (<-chan []byte, error) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	// Following needs a file to read, even if LazyCreate hasn't made one yet
+	err := lm.createPending()
+	if err != nil {
+		return nil, err
+	}
+	if lm.currentFile == nil || lm.closed {
+		return nil, os.ErrClosed
+	}
+	if lm.options.FIFO {
+		return nil, errors.New("unable to follow a FIFO")
+	}
+	if lm.streaming() {
+		return nil, errors.New("unable to follow a compressed stream")
+	}
+
+	// Start from the end of the current log, while nothing can be written to it
+	file, err := openAt(lm.currentFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	f := &follower{wake: make(chan struct{}, 1)}
+	if lm.followers == nil {
+		lm.followers = map[*follower]struct{}{}
+	}
+	lm.followers[f] = struct{}{}
+
+	lines := make(chan []byte)
+	go lm.follow(ctx, f, file, lines)
+	return lines, nil
+}
+
+// follow is a helper function that reads lines from file (and the logs rotated to after it) into lines, until ctx is
+// done or there's nothing more to read
+func (lm *LogManager) follow(ctx context.Context, f *follower, file *os.File, lines chan<- []byte) {
+	defer func() {
+		lm.Lock()
+		delete(lm.followers, f)
+		lm.Unlock()
+
+		// Anything we never got to isn't needed anymore
+		file.Close()
+		f.mu.Lock()
+		for _, next := range f.next {
+			next.Close()
+		}
+		f.mu.Unlock()
+		close(lines)
+	}()
+
+	var partial []byte
+	buf := make([]byte, 32*1024)
+	for {
+		// Send every complete line there is so far
+		n, err := file.Read(buf)
+		partial = append(partial, buf[:n]...)
+		for {
+			i := bytes.IndexByte(partial, '\n')
+			if i < 0 {
+				break
+			}
+			line := append([]byte(nil), partial[:i]...)
+			partial = partial[i+1:]
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if err != io.EOF {
+			lm.logf("unable to follow %s: %s", file.Name(), err)
+			return
+		}
+
+		// Once a rotated log's been read to the end, nothing else is coming, so move on to the next one (or stop, if
+		// the log manager's closed)
+		f.mu.Lock()
+		var next *os.File
+		if len(f.next) > 0 {
+			next, f.next = f.next[0], f.next[1:]
+		}
+		done := f.done
+		f.mu.Unlock()
+		if next != nil || done {
+			if len(partial) > 0 {
+				select {
+				case lines <- partial:
+				case <-ctx.Done():
+					return
+				}
+				partial = nil
+			}
+			if next == nil {
+				return
+			}
+			file.Close()
+			file = next
+			continue
+		}
+
+		select {
+		case <-f.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// rotateFollowers is a helper function that hands every follower the new log, opened where writes to it will start.
+// The lock must already be held.
+func (lm *LogManager) rotateFollowers() {
+	for f := range lm.followers {
+		file, err := openAt(lm.currentFile.Name())
+		if err != nil {
+			lm.logf("unable to follow new log file: %s", err)
+			continue
+		}
+		f.mu.Lock()
+		f.next = append(f.next, file)
+		f.mu.Unlock()
+		f.signal()
+	}
+}
+
+// wakeFollowers is a helper function that lets every follower know there's something new to read. If done is set, the
+// log manager's being closed, and they should stop once they've read it. The lock must already be held.
+func (lm *LogManager) wakeFollowers(done bool) {
+	for f := range lm.followers {
+		if done {
+			f.mu.Lock()
+			f.done = true
+			f.mu.Unlock()
+		}
+		f.signal()
+	}
+}
+
+// openAt is a helper function that opens the log at name for reading, from the end
+func openAt(name string) (*os.File, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,72 @@
+package logmanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	lm := setup(LogManagerOptions{FilenameFormat: "{{ .Iteration }}.log", MaxFileSize: 64, Header: "# app v1\n"})
+
+	// What's already there isn't followed
+	lm.Write([]byte("before\n"))
+	lines, err := lm.Follow(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write enough to rotate a few times, without waiting for the follower to keep up
+	var want []string
+	for i := 0; i < 50; i++ {
+		line := fmt.Sprintf("line %d", i)
+		want = append(want, line)
+		lm.Write([]byte(line + "\n"))
+	}
+	if lm.Stats().Rotations < 3 {
+		t.Fatalf("Only rotated %d times", lm.Stats().Rotations)
+	}
+	lm.Close()
+
+	// Everything should arrive in order, without the headers of the new files, then the channel should close
+	var got []string
+	for line := range lines {
+		got = append(got, string(line))
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Followed %q, expected %q", got, want)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestFollowCancel(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, err := lm.Follow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm.Write([]byte("one\n"))
+	line := <-lines
+	if string(line) != "one" {
+		t.Errorf("Followed %q, expected one", line)
+	}
+
+	// Cancelling should close the channel, and let go of the follower's files
+	cancel()
+	select {
+	case _, ok := <-lines:
+		if ok {
+			t.Error("Followed a line after being cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Channel wasn't closed after being cancelled")
+	}
+
+	lm.Close()
+	os.RemoveAll(lm.options.Dir)
+}
@@ -0,0 +1,8 @@
+//go:build !darwin && !freebsd && !linux
+
+package logmanager
+
+// freeSpace returns how many bytes are available to us on the filesystem dir is on, if the platform can tell us
+func freeSpace(dir string) (free int64, ok bool, err error) {
+	return 0, false, nil
+}
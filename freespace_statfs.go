@@ -0,0 +1,15 @@
+//go:build darwin || freebsd || linux
+
+package logmanager
+
+import "syscall"
+
+// freeSpace returns how many bytes are available to us on the filesystem dir is on
+func freeSpace(dir string) (free int64, ok bool, err error) {
+	var st syscall.Statfs_t
+	err = syscall.Statfs(dir, &st)
+	if err != nil {
+		return 0, false, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), true, nil
+}
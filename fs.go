@@ -0,0 +1,44 @@
+package logmanager
+
+import (
+	"os"
+	"time"
+)
+
+// filesystem is the set of filesystem operations the log manager routes through it, so that tests can swap in a mock
+type filesystem interface {
+	OpenFile(name string, flag int, perm os.FileMode) (*os.File, error)
+	Sync(f *os.File) error
+	SyncDir(dir string) error
+	FreeSpace(dir string) (free int64, ok bool, err error)
+	BirthTime(info os.FileInfo) (time.Time, bool)
+}
+
+// osFS is the real filesystem
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFS) Sync(f *os.File) error {
+	return f.Sync()
+}
+
+func (osFS) SyncDir(dir string) (err error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+func (osFS) FreeSpace(dir string) (int64, bool, error) {
+	return freeSpace(dir)
+}
+
+func (osFS) BirthTime(info os.FileInfo) (time.Time, bool) {
+	return birthTime(info)
+}
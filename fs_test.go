@@ -0,0 +1,274 @@
+package logmanager
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockFS wraps the real filesystem, recording the calls made through it
+type mockFS struct {
+	osFS
+	synced    []string
+	syncedDir []string
+
+	// The first failOpens calls to OpenFile fail with openErr
+	failOpens int
+	openErr   error
+	opens     int
+
+	// If reportFree is set, FreeSpace reports free instead of the real free space
+	free       int64
+	reportFree bool
+
+	// If reportBorn is set, BirthTime reports born instead of the real creation time (or that there isn't one, if it's zero)
+	born       time.Time
+	reportBorn bool
+}
+
+func (m *mockFS) BirthTime(info os.FileInfo) (time.Time, bool) {
+	if m.reportBorn {
+		return m.born, !m.born.IsZero()
+	}
+	return m.osFS.BirthTime(info)
+}
+
+func (m *mockFS) FreeSpace(dir string) (int64, bool, error) {
+	if m.reportFree {
+		return m.free, true, nil
+	}
+	return m.osFS.FreeSpace(dir)
+}
+
+func (m *mockFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	m.opens++
+	if m.opens <= m.failOpens {
+		return nil, &os.PathError{Op: "open", Path: name, Err: m.openErr}
+	}
+	return m.osFS.OpenFile(name, flag, perm)
+}
+
+func (m *mockFS) Sync(f *os.File) error {
+	m.synced = append(m.synced, f.Name())
+	return m.osFS.Sync(f)
+}
+
+func (m *mockFS) SyncDir(dir string) error {
+	m.syncedDir = append(m.syncedDir, dir)
+	return m.osFS.SyncDir(dir)
+}
+
+func TestSyncDir(t *testing.T) {
+	for _, syncDir := range []bool{true, false} {
+		lm := setup(LogManagerOptions{
+			GZIP:    true,
+			SyncDir: syncDir,
+		})
+		fs := &mockFS{}
+		lm.fs = fs
+
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !syncDir {
+			if len(fs.synced) != 0 || len(fs.syncedDir) != 0 {
+				t.Error("Archive was synced with SyncDir disabled")
+			}
+			os.RemoveAll(lm.options.Dir)
+			continue
+		}
+
+		// The temp archive should be synced before it's renamed, then the directory after
+		if len(fs.synced) != 1 || !strings.HasSuffix(fs.synced[0], ".tmp") {
+			t.Errorf("Temp archive was not synced: %v", fs.synced)
+		}
+		if len(fs.syncedDir) != 1 || fs.syncedDir[0] != lm.options.Dir {
+			t.Errorf("Log directory was not synced: %v", fs.syncedDir)
+		}
+
+		os.RemoveAll(lm.options.Dir)
+	}
+}
+
+func TestRotateRetries(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		RotateRetries: 3,
+		RotateBackoff: time.Millisecond,
+	})
+
+	// Transient errors should be retried until the open succeeds
+	fs := &mockFS{failOpens: 2, openErr: errors.New("transient")}
+	lm.fs = fs
+	old := lm.currentFile.Name()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.opens != 3 || lm.currentFile.Name() == old {
+		t.Errorf("Rotation was not retried, %d opens", fs.opens)
+	}
+
+	// Too many failures should give up
+	lm.fs = &mockFS{failOpens: 4, openErr: errors.New("transient")}
+	err = lm.Rotate()
+	if err == nil {
+		t.Error("Rotation did not give up after running out of retries")
+	}
+
+	// Permanent errors shouldn't be retried at all
+	fs = &mockFS{failOpens: 1, openErr: os.ErrPermission}
+	lm.fs = fs
+	err = lm.Rotate()
+	if err == nil || fs.opens != 1 {
+		t.Errorf("Permanent error was retried, %d opens", fs.opens)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestHealthy(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+
+	err := lm.Healthy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Permissions don't stop root, or apply to Windows directories
+	if runtime.GOOS != "windows" && os.Geteuid() != 0 {
+		os.Chmod(lm.options.Dir, 0555)
+		err = lm.Healthy()
+		os.Chmod(lm.options.Dir, 0755)
+		if err == nil {
+			t.Error("Read-only directory was reported healthy")
+		}
+	}
+
+	// Simulate the permissions problem instead
+	lm.fs = &mockFS{failOpens: 1, openErr: os.ErrPermission}
+	err = lm.Healthy()
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Expected a permission error, got %v", err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestFailedRotationKeepsOldFile(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+	old := lm.CurrentFilename()
+	lm.Write([]byte("before "))
+
+	// The new file can't be opened
+	lm.fs = &mockFS{failOpens: 1, openErr: os.ErrPermission}
+	err := lm.Rotate()
+	if err == nil {
+		t.Fatal("Rotation didn't fail")
+	}
+	lm.fs = osFS{}
+
+	// The template can't be executed
+	options := lm.Options()
+	options.FilenameFormat = "{{ .Nope }}"
+	err = lm.Reconfigure(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lm.Rotate()
+	if err == nil {
+		t.Fatal("Rotation didn't fail")
+	}
+
+	// Either way, logging should carry on in the old file
+	_, err = lm.Write([]byte("after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lm.CurrentFilename() != old {
+		t.Errorf("Logging to %s instead of %s", lm.CurrentFilename(), old)
+	}
+	b, err := os.ReadFile(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "before after" {
+		t.Errorf("Log contains %q, expected %q", b, "before after")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestRetentionAfterFailedRotation(t *testing.T) {
+	lm := setup(LogManagerOptions{MaxBackups: 1})
+	lm.Write([]byte("backup"))
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := lm.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pretend the disk is full, so the new file can't be created
+	lm.Write([]byte("current"))
+	lm.fs = &mockFS{failOpens: 1, openErr: errors.New("no space left on device")}
+	err = lm.Rotate()
+	if err == nil {
+		t.Fatal("Rotation didn't fail")
+	}
+
+	// Nothing should have been deleted to make room
+	after, err := lm.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) || after[0].path != before[0].path {
+		t.Errorf("Backups changed from %v to %v", before, after)
+	}
+	if b, err := os.ReadFile(before[0].path); err != nil || string(b) != "backup" {
+		t.Errorf("Backup contains %q (%v), expected %q", b, err, "backup")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestMinFreeBytes(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		MaxFileSize:  10,
+		MinFreeBytes: 1000,
+	})
+	fs := &mockFS{free: 500, reportFree: true}
+	lm.fs = fs
+	current := lm.CurrentFilename()
+
+	err := lm.Rotate()
+	if !errors.Is(err, ErrLowDiskSpace) {
+		t.Fatalf("Rotating with low disk space returned %v, expected ErrLowDiskSpace", err)
+	}
+
+	// Writes should carry on in the current file, even once it's over MaxFileSize
+	for i := 0; i < 3; i++ {
+		_, err = lm.Write([]byte("12345678\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lm.CurrentFilename() != current {
+		t.Errorf("Rotated to %s with low disk space", lm.CurrentFilename())
+	}
+
+	// Once there's room again, it should rotate as usual
+	fs.free = 5000
+	lm.Write([]byte("12345678\n"))
+	if lm.CurrentFilename() == current {
+		t.Error("Didn't rotate once there was enough free space")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
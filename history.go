@@ -0,0 +1,320 @@
+package logmanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenHistory returns a single stream of every log the log manager has kept, oldest first, followed by the current log.
+// Compressed logs are decompressed on the fly.
+func (lm *LogManager) OpenHistory() (io.ReadCloser, error) {
+	lm.Lock()
+	found, err := lm.backups()
+	var current string
+	if lm.currentFile != nil {
+		current = lm.currentFile.Name()
+	}
+	shiftMode := lm.options.ShiftMode
+	lm.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Shifted logs are already oldest first, everything else gets sorted by name
+	if !shiftMode {
+		sort.SliceStable(found, func(i, j int) bool {
+			return naturalLess(historyKey(found[i].path), historyKey(found[j].path))
+		})
+	}
+
+	var paths []string
+	for _, b := range found {
+		paths = append(paths, b.path)
+	}
+	if current != "" {
+		paths = append(paths, current)
+	}
+
+	return &historyReader{paths: paths}, nil
+}
+
+// OpenArchive opens the log covering the time at, decompressing it if it's an archive. If no log covers it, the error
+// wraps os.ErrNotExist.
+func (lm *LogManager) OpenArchive(at time.Time) (io.ReadCloser, error) {
+	lm.Lock()
+	found, err := lm.backups()
+	var current string
+	if lm.currentFile != nil {
+		current = lm.currentFile.Name()
+		if info, statErr := os.Stat(current); statErr == nil {
+			found = append(found, backup{current, info})
+		}
+	}
+	pattern, _ := compileFilenamePattern(lm.templater)
+	lm.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	type dated struct {
+		path      string
+		start     time.Time // Zero if we can't tell
+		iteration uint
+		end       time.Time
+		current   bool // The current log hasn't ended
+	}
+	var logs []dated
+	for _, b := range found {
+		d := dated{path: b.path, end: b.info.ModTime(), current: b.path == current}
+		if pattern != nil {
+			d.start, d.iteration, _ = pattern.parse(b.path)
+		}
+		logs = append(logs, d)
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		if !logs[i].start.Equal(logs[j].start) {
+			return logs[i].start.Before(logs[j].start)
+		}
+		if logs[i].iteration != logs[j].iteration {
+			return logs[i].iteration < logs[j].iteration
+		}
+		return logs[i].end.Before(logs[j].end)
+	})
+
+	// The newest log that started by at, and hadn't ended yet, so at a rotation the new log wins
+	var match string
+	for _, d := range logs {
+		if d.start.After(at) {
+			break
+		}
+		if d.current || !d.end.Before(at) {
+			match = d.path
+		}
+	}
+	if match != "" {
+		return openLog(match)
+	}
+
+	return nil, fmt.Errorf("unable to find a log covering %s: %w", at, os.ErrNotExist)
+}
+
+// historyKey is a helper function that returns the part of a log's name to sort it by, without any extensions
+func historyKey(path string) string {
+	name := filepath.Base(path)
+	if ext := archiveExt(name); ext != "" {
+		return strings.TrimSuffix(name, ext)
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// naturalLess is a helper function that compares strings with runs of digits compared by their value, so _2 sorts before _10
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := digits(a), digits(b)
+			x, y := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(x) != len(y) {
+				return len(x) < len(y)
+			}
+			if x != y {
+				return x < y
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// digits is a helper function that returns how many digits s starts with
+func digits(s string) (n int) {
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return
+}
+
+// historyReader reads each of paths in turn, opening them as it gets to them
+type historyReader struct {
+	paths   []string
+	current io.ReadCloser
+}
+
+func (h *historyReader) Read(p []byte) (n int, err error) {
+	for {
+		if h.current == nil {
+			if len(h.paths) == 0 {
+				return 0, io.EOF
+			}
+			h.current, err = openLog(h.paths[0])
+			h.paths = h.paths[1:]
+
+			// It might've been rotated away (or deleted) since we listed it
+			if errors.Is(err, os.ErrNotExist) {
+				h.current = nil
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		n, err = h.current.Read(p)
+		if err == io.EOF {
+			h.current.Close()
+			h.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return
+	}
+}
+
+func (h *historyReader) Close() error {
+	h.paths = nil
+	if h.current != nil {
+		return h.current.Close()
+	}
+	return nil
+}
+
+// openLog is a helper function that opens a log for reading, decompressing it if it's an archive.
+// Archives with more than one log in them (like bundles) are read as one log after the other.
+func openLog(path string) (io.ReadCloser, error) {
+	if archiveExt(path) == ".zip" {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		return &zipReader{zr: zr, files: zr.File}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch archiveExt(path) {
+	case ".tar.gz":
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &tarReader{tr: tar.NewReader(gr), gr: gr, f: f}, nil
+	case ".gz":
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &gzipReader{gr, f}, nil
+	}
+
+	return f, nil
+}
+
+// gzipReader closes the underlying file along with the gzip reader
+type gzipReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipReader) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+// tarReader reads every file in a tar.gz archive, one after the other
+type tarReader struct {
+	tr      *tar.Reader
+	gr      *gzip.Reader
+	f       *os.File
+	started bool
+}
+
+func (t *tarReader) Read(p []byte) (n int, err error) {
+	for {
+		if t.started {
+			n, err = t.tr.Read(p)
+			if err != io.EOF || n > 0 {
+				if err == io.EOF {
+					err = nil
+				}
+				return
+			}
+		}
+
+		// Move on to the next file
+		_, err = t.tr.Next()
+		if err != nil {
+			return 0, err
+		}
+		t.started = true
+	}
+}
+
+func (t *tarReader) Close() error {
+	t.gr.Close()
+	return t.f.Close()
+}
+
+// zipReader reads every file in a zip archive, one after the other
+type zipReader struct {
+	zr      *zip.ReadCloser
+	files   []*zip.File
+	current io.ReadCloser
+}
+
+func (z *zipReader) Read(p []byte) (n int, err error) {
+	for {
+		if z.current == nil {
+			if len(z.files) == 0 {
+				return 0, io.EOF
+			}
+			z.current, err = z.files[0].Open()
+			z.files = z.files[1:]
+			if err != nil {
+				z.current = nil
+				return 0, err
+			}
+		}
+
+		n, err = z.current.Read(p)
+		if err == io.EOF {
+			z.current.Close()
+			z.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return
+	}
+}
+
+func (z *zipReader) Close() error {
+	if z.current != nil {
+		z.current.Close()
+	}
+	return z.zr.Close()
+}
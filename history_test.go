@@ -0,0 +1,106 @@
+package logmanager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenHistory(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+
+	// Leave a mix of plain and compressed logs behind, with enough of them that iterations need sorting by value
+	var want strings.Builder
+	for i := 0; i < 12; i++ {
+		options := lm.Options()
+		options.GZIP = i%4 != 0
+		options.CompressionFormat = []CompressionFormat{CompressTarGz, CompressTarGz, CompressZip, CompressGzip}[i%4]
+		err := lm.Reconfigure(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line := fmt.Sprintf("line %d\n", i)
+		lm.Write([]byte(line))
+		want.WriteString(line)
+		err = lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	lm.Write([]byte("current\n"))
+	want.WriteString("current\n")
+
+	r, err := lm.OpenHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want.String() {
+		t.Errorf("History is %q, expected %q", b, want.String())
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestOpenArchive(t *testing.T) {
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		FilenameFormat: `{{ .Time.Format "2006-01-02T15" }}.log`,
+		GZIP:           true,
+		Now:            func() time.Time { return now },
+	})
+
+	// An hour per log, each compressed when it's rotated away from
+	for _, hour := range []string{"ten", "eleven", "twelve"} {
+		lm.Write([]byte(hour + "\n"))
+		if hour == "twelve" {
+			break
+		}
+		old := lm.CurrentFilename()
+		now = now.Add(time.Hour)
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(lm.archivePath(old), now, now)
+	}
+
+	for _, test := range []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2022, 5, 17, 10, 30, 0, 0, time.Local), "ten\n"},
+		{time.Date(2022, 5, 17, 11, 0, 0, 0, time.Local), "eleven\n"},
+		{time.Date(2022, 5, 17, 11, 59, 0, 0, time.Local), "eleven\n"},
+		{time.Date(2022, 5, 17, 12, 15, 0, 0, time.Local), "twelve\n"}, // The current log
+	} {
+		r, err := lm.OpenArchive(test.at)
+		if err != nil {
+			t.Fatalf("Couldn't open the log for %s: %s", test.at, err)
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.want {
+			t.Errorf("Log for %s contains %q, expected %q", test.at.Format("15:04"), b, test.want)
+		}
+	}
+
+	_, err := lm.OpenArchive(time.Date(2022, 5, 17, 9, 0, 0, 0, time.Local))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Opening a log from before the first one returned %v, expected os.ErrNotExist", err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
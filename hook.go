@@ -0,0 +1,49 @@
+package logmanager
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// ErrReentrantWrite is returned by Write when it's called from a hook (like AfterCompress, CollisionResolver, or Logger)
+// that the log manager is running, possibly with its lock held, which would otherwise deadlock
+var ErrReentrantWrite = errors.New("log manager was written to from one of its own hooks")
+
+// hook is a helper function that runs fn, which calls the user's code (a hook, Logger, a tee, etc.), noting which
+// goroutine it's on so that writes from inside of it can be refused. More than one goroutine can be in one at a time.
+func (lm *LogManager) hook(fn func()) {
+	g := goroutineID()
+	if _, nested := lm.hooking.LoadOrStore(g, true); !nested {
+		atomic.AddInt64(&lm.hooks, 1)
+		defer func() {
+			lm.hooking.Delete(g)
+			atomic.AddInt64(&lm.hooks, -1)
+		}()
+	}
+
+	fn()
+}
+
+// inHook is a helper function that checks if we're being called from inside of a hook. It's cheap when no hook is running.
+func (lm *LogManager) inHook() bool {
+	if atomic.LoadInt64(&lm.hooks) == 0 {
+		return false
+	}
+	_, ok := lm.hooking.Load(goroutineID())
+	return ok
+}
+
+// goroutineID is a helper function that returns the ID of the calling goroutine, from the header of its stack trace
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
@@ -0,0 +1,97 @@
+package logmanager
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReentrantWrite(t *testing.T) {
+	var hookErr error
+	var lm *LogManager
+	lm = setup(LogManagerOptions{
+		GZIP: true,
+		AfterCompress: func(archivePath string, err error) {
+			_, hookErr = lm.Write([]byte("from the hook\n"))
+		},
+	})
+
+	done := make(chan error)
+	go func() { done <- lm.Rotate() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Writing from a hook deadlocked")
+	}
+	if !errors.Is(hookErr, ErrReentrantWrite) {
+		t.Errorf("Write from a hook returned %v, expected ErrReentrantWrite", hookErr)
+	}
+
+	// Writes from anywhere else are fine
+	_, err := lm.Write([]byte("after\n"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestReentrantLogger(t *testing.T) {
+	lm := setup(LogManagerOptions{DryRun: true})
+	var tee []byte
+	opts := lm.Options()
+	opts.Logger = log.New(lm, "", 0)
+	opts.Tee = []io.Writer{writerFunc(func(p []byte) (int, error) {
+		tee = append(tee, p...)
+		return lm.Write(p)
+	})}
+	err := lm.Reconfigure(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := lm.Write([]byte("hello\n"))
+		if err == nil {
+			err = lm.Rotate()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Writing from Logger or a tee deadlocked")
+	}
+	if string(tee) != "hello\n" {
+		t.Errorf("Tee got %q", tee)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestGoroutineID(t *testing.T) {
+	id := goroutineID()
+	if id <= 0 {
+		t.Fatalf("Got goroutine ID %d", id)
+	}
+	other := make(chan int64)
+	go func() { other <- goroutineID() }()
+	if <-other == id {
+		t.Error("Different goroutines got the same ID")
+	}
+}
+
+// writerFunc adapts a function to io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,70 @@
+package logmanager
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// armIdleTimer is a helper function that starts waiting to close the current file, if CloseWhenIdle is set and we aren't already.
+// The lock must already be held.
+func (lm *LogManager) armIdleTimer() {
+	if lm.options.CloseWhenIdle > 0 && lm.idleTimer == nil {
+		lm.idleTimer = time.AfterFunc(lm.options.CloseWhenIdle, lm.closeIfIdle)
+	}
+}
+
+// stopIdleTimer is a helper function that stops waiting to close the current file. The lock must already be held.
+func (lm *LogManager) stopIdleTimer() {
+	if lm.idleTimer != nil {
+		lm.idleTimer.Stop()
+		lm.idleTimer = nil
+	}
+}
+
+// closeIfIdle closes the current file if nothing has been written to it for CloseWhenIdle, keeping its name so the
+// next write can reopen it. If something has been written since, it waits for the rest of the idle period instead.
+func (lm *LogManager) closeIfIdle() {
+	lm.Lock()
+	defer lm.Unlock()
+
+	// Check if we've been stopped in the meantime
+	if lm.idleTimer == nil {
+		return
+	}
+	lm.idleTimer = nil
+	if lm.currentFile == nil || lm.idle || lm.options.CloseWhenIdle <= 0 {
+		return
+	}
+
+	// Check if there's been a write since the timer was started
+	if remaining := lm.options.CloseWhenIdle - lm.options.Now().Sub(lm.lastWrite); remaining > 0 {
+		lm.idleTimer = time.AfterFunc(remaining, lm.closeIfIdle)
+		return
+	}
+
+	err := lm.closeFile(lm.currentFile)
+	if err != nil {
+		lm.logf("unable to close idle log file: %s", err)
+		return
+	}
+	lm.idle = true
+}
+
+// wake is a helper function that reopens the current file if it was closed for being idle, appending to where it left off.
+// The lock must already be held.
+func (lm *LogManager) wake() error {
+	if !lm.idle {
+		return nil
+	}
+
+	f, err := lm.fs.OpenFile(lm.currentFile.Name(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to reopen idle log file: %w", err)
+	}
+	lm.currentFile = f
+	lm.idle = false
+	lm.startStream()
+
+	return nil
+}
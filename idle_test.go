@@ -0,0 +1,91 @@
+package logmanager
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCloseWhenIdle(t *testing.T) {
+	now := time.Date(2022, 5, 17, 12, 0, 0, 0, time.UTC)
+	lm := setup(LogManagerOptions{
+		CloseWhenIdle: time.Hour,
+		Now:           func() time.Time { return now },
+	})
+	name := lm.CurrentFilename()
+
+	lm.Write([]byte("before "))
+	lm.Lock()
+	armed := lm.idleTimer != nil
+	lm.Unlock()
+	if !armed {
+		t.Fatal("Write didn't start waiting for the file to go idle")
+	}
+
+	// Not idle for long enough yet
+	now = now.Add(time.Minute * 30)
+	lm.closeIfIdle()
+	if lm.idle {
+		t.Fatal("File was closed before it went idle")
+	}
+
+	// Fire the timer rather than waiting for it
+	now = now.Add(time.Hour)
+	lm.closeIfIdle()
+	if !lm.idle {
+		t.Fatal("Idle file wasn't closed")
+	}
+	if _, err := lm.currentFile.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Error("Idle file descriptor is still open")
+	}
+
+	// The next write should reopen the same file, and append to it
+	_, err := lm.Write([]byte("after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lm.CurrentFilename() != name {
+		t.Errorf("Reopening rotated to %s", lm.CurrentFilename())
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "before after" {
+		t.Errorf("Log contains %q, expected %q", b, "before after")
+	}
+
+	lm.Close()
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestReconfigureCloseWhenIdle(t *testing.T) {
+	options := LogManagerOptions{CloseWhenIdle: time.Hour}
+	lm := setup(options)
+	lm.Write([]byte("test"))
+
+	// The timer that's already waiting an hour should make way for the new idle period
+	options.Dir = lm.options.Dir
+	options.CloseWhenIdle = time.Millisecond * 20
+	err := lm.Reconfigure(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		lm.Lock()
+		idle := lm.idle
+		lm.Unlock()
+		if idle {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("File wasn't closed after the new idle period")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	lm.Close()
+	os.RemoveAll(lm.options.Dir)
+}
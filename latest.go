@@ -0,0 +1,62 @@
+package logmanager
+
+import (
+	"io"
+	"os"
+)
+
+// LatestStrategy controls how the "latest" pointer to the current log is kept, for filesystems that don't support symlinks
+type LatestStrategy int
+
+const (
+	// LatestSymlink makes "latest" a symlink to the current log (default)
+	LatestSymlink LatestStrategy = iota
+	// LatestHardlink makes "latest" a hard link to the current log
+	LatestHardlink
+	// LatestCopy makes "latest" a copy of the current log, which is kept up to date on every write
+	LatestCopy
+	// LatestPointer makes "latest" a text file containing the path of the current log
+	LatestPointer
+)
+
+// RefreshLatest recreates "latest" for the current log, e.g. if it's been deleted or broken from outside. It does nothing
+// unless LatestDotLog is set.
+func (lm *LogManager) RefreshLatest() error {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if !lm.options.LatestDotLog {
+		return nil
+	}
+	// latest needs something to point to
+	err := lm.createPending()
+	if err != nil {
+		return err
+	}
+	if lm.currentFile == nil || lm.closed {
+		return os.ErrClosed
+	}
+	return lm.setSymlink()
+}
+
+// copyLatest is a helper function that copies the current log to latest, then keeps it open so writes can be mirrored to it
+func (lm *LogManager) copyLatest(latest string) (err error) {
+	src, err := os.Open(lm.currentFile.Name())
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	lm.latestFile, err = os.OpenFile(latest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+
+	_, err = io.Copy(lm.latestFile, src)
+	return
+}
+
+// writePointer is a helper function that writes the path of the current log into latest
+func (lm *LogManager) writePointer(latest string) error {
+	return os.WriteFile(latest, []byte(lm.currentFile.Name()+"\n"), 0644)
+}
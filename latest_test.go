@@ -0,0 +1,267 @@
+package logmanager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// supports is a helper function that checks whether the temp filesystem supports a type of link
+func supports(t *testing.T, link func(oldname, newname string) error) bool {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := os.WriteFile(target, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return link(target, filepath.Join(dir, "link")) == nil
+}
+
+func TestLatestSymlink(t *testing.T) {
+	if !supports(t, os.Symlink) {
+		t.Skip("Filesystem doesn't support symlinks")
+	}
+
+	lm := setup(LogManagerOptions{
+		LatestDotLog:   true,
+		LatestStrategy: LatestSymlink,
+	})
+
+	target, err := os.Readlink(filepath.Join(lm.options.Dir, "latest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != lm.currentFile.Name() {
+		t.Errorf("latest points to %s instead of %s", target, lm.currentFile.Name())
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestSymlinkTargetFunc(t *testing.T) {
+	if !supports(t, os.Symlink) {
+		t.Skip("Filesystem doesn't support symlinks")
+	}
+
+	// As a container that mounts Dir at /mnt/logs would see it
+	lm := setup(LogManagerOptions{
+		LatestDotLog: true,
+		SymlinkTargetFunc: func(currentPath string) string {
+			return filepath.Join("/mnt/logs", filepath.Base(currentPath))
+		},
+	})
+
+	target, err := os.Readlink(filepath.Join(lm.options.Dir, "latest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("/mnt/logs", filepath.Base(lm.currentFile.Name())); target != want {
+		t.Errorf("latest points to %s instead of %s", target, want)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestLatestHardlink(t *testing.T) {
+	if !supports(t, os.Link) {
+		t.Skip("Filesystem doesn't support hard links")
+	}
+
+	lm := setup(LogManagerOptions{
+		LatestDotLog:   true,
+		LatestStrategy: LatestHardlink,
+	})
+
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm.Write([]byte("test"))
+
+	// Check that latest is the same file as the current log
+	latest, err := os.Stat(filepath.Join(lm.options.Dir, "latest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := os.Stat(lm.currentFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(latest, current) {
+		t.Error("latest is not a hard link to the current log")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestLatestCopy(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		LatestDotLog:   true,
+		LatestStrategy: LatestCopy,
+	})
+
+	lm.Write([]byte("test1"))
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm.Write([]byte("test2"))
+
+	// Check that the copy only has the current log's content
+	b, err := os.ReadFile(filepath.Join(lm.options.Dir, "latest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "test2" {
+		t.Errorf("latest contains %q, expected %q", b, "test2")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestLatestPointer(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		LatestDotLog:   true,
+		LatestStrategy: LatestPointer,
+	})
+
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(lm.options.Dir, "latest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(b)) != lm.currentFile.Name() {
+		t.Errorf("latest contains %q, expected %q", b, lm.currentFile.Name())
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestLatestRealFile(t *testing.T) {
+	for _, options := range []LogManagerOptions{
+		{LatestDotLog: true},
+		{LatestDotLog: false},
+	} {
+		lm := setup(options)
+
+		// Replace latest with a real file
+		latest := filepath.Join(lm.options.Dir, "latest")
+		os.Remove(latest)
+		err := os.WriteFile(latest, []byte("important"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = lm.Rotate()
+		if options.LatestDotLog && err == nil {
+			t.Error("Rotate did not refuse to replace a real file")
+		} else if !options.LatestDotLog && err != nil {
+			t.Error(err)
+		}
+
+		// Check that the file survived
+		b, err := os.ReadFile(latest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "important" {
+			t.Error("Real file named latest was clobbered")
+		}
+
+		os.RemoveAll(lm.options.Dir)
+	}
+
+	// With ForceLatest, it should get replaced
+	if !supports(t, os.Symlink) {
+		t.Skip("Filesystem doesn't support symlinks")
+	}
+	lm := setup(LogManagerOptions{LatestDotLog: true, ForceLatest: true})
+	latest := filepath.Join(lm.options.Dir, "latest")
+	os.Remove(latest)
+	err := os.WriteFile(latest, []byte("important"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Readlink(latest); err != nil {
+		t.Error("latest was not replaced with ForceLatest")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestManageLatestOnly(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone else's files, in a shared directory
+	for _, name := range []string{"latest", "latest.log"} {
+		err = os.WriteFile(filepath.Join(dir, name), []byte("not ours"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lm := NewLogManager(LogManagerOptions{Dir: dir, ManageLatestOnly: true})
+	lm.Write([]byte("test"))
+	err = lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"latest", "latest.log"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "not ours" {
+			t.Errorf("%s was clobbered", name)
+		}
+	}
+
+	os.RemoveAll(dir)
+}
+
+func TestRefreshLatest(t *testing.T) {
+	if !supports(t, os.Symlink) {
+		t.Skip("Filesystem doesn't support symlinks")
+	}
+
+	lm := setup(LogManagerOptions{LatestDotLog: true})
+	latest := filepath.Join(lm.options.Dir, "latest")
+	os.Remove(latest)
+
+	err := lm.RefreshLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Readlink(latest)
+	if err != nil {
+		t.Fatalf("latest wasn't restored: %s", err)
+	}
+	if target != lm.CurrentFilename() {
+		t.Errorf("latest points to %s instead of %s", target, lm.CurrentFilename())
+	}
+	os.RemoveAll(lm.options.Dir)
+
+	// Without LatestDotLog, there's nothing to restore
+	lm = setup(LogManagerOptions{})
+	err = lm.RefreshLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(lm.options.Dir, "latest")); !os.IsNotExist(err) {
+		t.Error("latest was created without LatestDotLog")
+	}
+	os.RemoveAll(lm.options.Dir)
+}
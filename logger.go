@@ -5,66 +5,333 @@ package logmanager
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 )
 
 // LogManager is the main struct of the package. It implements io.Writer, and is safe for concurrent use.
 type LogManager struct {
-	sync.Mutex
+	// Accessed atomically, so these are kept first for alignment on 32-bit platforms
+	writeTimeout int64 // Write needs it before taking the lock
+	compressing  int64 // Background compressions still running
+	sequence     uint64
+	hooks        int64 // How many goroutines are running a hook
+	stats        counters
+
+	mutex
 
 	options      LogManagerOptions
 	templater    *template.Template
+	marker       *template.Template // Nil unless RotationMarker is set
+	ownsLatest   bool               // Whether latest in Dir was made by us
 	currentFile  *os.File
+	latestFile   *os.File
 	lastRotation time.Time
+	currentBase  string // What the current file would've been called without any iterations
+	started      time.Time
+	compressor   func(ctx context.Context, filename, dest string) error
+	fs           filesystem
+	workers      sync.WaitGroup // Background compressions
+	lastWrite    time.Time
+	idle         bool        // Whether currentFile has been closed for being idle
+	idleTimer    *time.Timer // Nil unless we're waiting to close an idle file
+	closed       bool
+	shuttingDown bool         // Set as soon as Close starts tearing down, so writes racing with it are turned away
+	opened       bool         // Set once Open has succeeded, since there's nothing to write to before then
+	pending      bool         // Whether the next write has to rotate first, since LazyCreate put off creating its file
+	writes       int          // Writes to the current file since it was opened
+	overhead     int64        // Bytes we've added to the current file ourselves (BOM, header, sequence numbers)
+	onDrop       atomic.Value // OnDrop, since it's called outside the lock
+	queue        writeQueue
+	syslog       *syslogTee // Nil unless Syslog is set
+	followers    map[*follower]struct{}
+	adopted      string          // AdoptFile's path, until it's been rotated away from
+	rotateCtx    context.Context // Nil unless RotateContext is running
+	closing      chan struct{}   // Closed once Close is called, to cut DeleteDelay short
+	closeOnce    sync.Once
+	hooking      sync.Map       // The goroutines running a hook, which mustn't write to us
+	inFlight     sync.Map       // Originals still being compressed in the background, or waiting on DeleteDelay, which retention leaves alone
+	tees         []io.Writer    // Tee, less any that TeeErrorPolicy has removed
+	sink         io.WriteCloser // WriterFactory's writer for the current file, nil until the first write to it
+	stream       *gzip.Writer   // Nil unless StreamCompress is set
+	streamTail   byte           // The last byte written to stream, if anything has been
+	now          atomic.Value   // Now, since Stats needs it outside the lock
+	bursting     bool           // Whether the write rate is above BurstRate
+}
+
+// Rotator is the interface implemented by LogManager, so consumers can depend on (and mock) it instead of the concrete type
+type Rotator interface {
+	io.Writer
+	Rotate() error
+	Close() error
+	CurrentFilename() string
 }
 
+var _ Rotator = (*LogManager)(nil)
+var _ io.WriterTo = (*LogManager)(nil)
+
 type LogManagerOptions struct {
-	Dir              string
-	FilenameFormat   string
-	RotationInterval time.Duration
-	MaxFileSize      int64
-	GZIP             bool
-	LatestDotLog     bool
+	Dir                   string
+	FilenameFormat        string
+	RotationInterval      time.Duration
+	MaxFileSize           int64
+	GZIP                  bool
+	LatestDotLog          bool
+	ShiftMode             bool
+	BundleOnClose         bool
+	WriteTimeout          time.Duration
+	WriteManifest         bool
+	DryRun                bool
+	Logger                *log.Logger
+	LatestStrategy        LatestStrategy
+	MinFileSize           int64
+	MaxIteration          uint
+	ForceLatest           bool
+	SymlinkTargetFunc     func(currentPath string) string
+	ArchiveDir            string
+	WriteBOM              bool
+	SlowRotationThreshold time.Duration
+	Now                   func() time.Time
+	RotateOnNameChange    bool
+	SyncDir               bool
+	CollisionResolver     func(base string, attempt uint) string
+	MaxBackups            int
+	MaxFiles              int
+	MaxTotalLines         int64
+	AsyncCompress         bool
+	AfterCompress         func(archivePath string, err error)
+	FIFO                  bool
+	RotateRetries         int
+	RotateBackoff         time.Duration
+	StartupGrace          time.Duration
+	RotationMarker        string
+	ManageLatestOnly      bool
+	CompressionFormat     CompressionFormat
+	CloseWhenIdle         time.Duration
+	OversizedWrites       OversizePolicy
+	RotationSchedule      RotationSchedule
+	StartIteration        uint
+	WritePIDFile          bool
+	PIDFileStrict         bool
+	CopyBufferSize        int
+	ExpandEnv             bool
+	GZIPComment           string
+	TarEntryNameFunc      func(logPath string) string
+	MaxWrites             int
+	SharedRetention       *RetentionGroup
+	SequenceNumbers       bool
+	Header                string
+	ExcludeOverhead       bool
+	AdoptFile             string
+	WriteArchiveMeta      bool
+	PartitionBy           Partition
+	FreshOnStart          bool
+	LazyCreate            bool
+	ArchivePipe           func(w io.Writer) io.WriteCloser
+	AppendArchiveExt      bool
+	AsyncQueue            int
+	QueueFullPolicy       QueuePolicy
+	RepairArchivesOnStart bool
+	KeepFirstPerPeriod    Period
+	KeepAllFor            time.Duration
+	FilenameTimeFunc      func() time.Time
+	MinFreeBytes          int64
+	ShouldRotate          func(currentSize int64, age time.Duration, pending []byte) bool
+	OnDrop                func(p []byte, err error)
+	Syslog                *SyslogConfig
+	SkipEmptyRotation     bool
+	UploadArchive         func(ctx context.Context, name string, r io.Reader) error
+	DeleteAfterUpload     bool
+	CompressAdopted       bool
+	MinRotationInterval   time.Duration
+	RotateDebounce        time.Duration
+	DeleteDelay           time.Duration
+	EnsureTrailingNewline bool
+	Tee                   []io.Writer
+	TeeErrorPolicy        TeeErrorPolicy
+	WriterFactory         func(filename string) (io.WriteCloser, error)
+	ReuseWriter           bool
+	StreamCompress        bool
+	TempSuffix            string
+	RateWindow            time.Duration
+	BurstRate             float64
 }
 
+// utf8BOM is written to the start of new files when WriteBOM is set
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// DefaultTempSuffix is what the names of files that are still being written end with, when TempSuffix isn't set
+const DefaultTempSuffix = ".tmp"
+
+// DefaultMaxIteration is the highest Iteration a rotation will try when MaxIteration isn't set
+const DefaultMaxIteration = 100000
+
+// ErrWriteTimeout is returned by Write when WriteTimeout elapses before the log manager becomes available
+var ErrWriteTimeout = errors.New("timed out waiting for log manager")
+
+// ErrLowDiskSpace is returned by Rotate when there's less than MinFreeBytes free, even after enforcing retention
+var ErrLowDiskSpace = errors.New("not enough free disk space to rotate")
+
+// ErrNotOpen is returned by Write and Rotate on a log manager from New that hasn't been opened yet
+var ErrNotOpen = errors.New("log manager hasn't been opened")
+
+// ErrWriteTooLarge is returned by Write when a single write is bigger than MaxFileSize, and OversizedWrites is OversizeReject
+var ErrWriteTooLarge = errors.New("write is larger than the max file size")
+
+// OversizePolicy controls what happens to a single write that's bigger than MaxFileSize
+type OversizePolicy int
+
+const (
+	// OversizeWrite writes it to a new file anyway, leaving that file over the max file size (default)
+	OversizeWrite OversizePolicy = iota
+	// OversizeReject refuses it with ErrWriteTooLarge, without writing anything
+	OversizeReject
+	// OversizeSplit splits it across as many files as it takes to keep each of them under the max file size
+	OversizeSplit
+)
+
 type LogTemplate struct {
 	Time      time.Time
 	Iteration uint
+	Previous  string
 }
 
-// Rotate manually triggers a log rotation
+// Rotate manually triggers a log rotation. With RotateDebounce, it does nothing if the last rotation was too recent.
+// Once Close has been called, it returns os.ErrClosed.
 func (lm *LogManager) Rotate() (err error) {
 	lm.Lock()
 	defer lm.Unlock()
 
+	// Close might already be waiting on the background work a rotation would start
+	if lm.shuttingDown || lm.closed {
+		return os.ErrClosed
+	}
+	if !lm.opened {
+		return ErrNotOpen
+	}
+	if lm.debounced() {
+		return nil
+	}
+	return lm.rotate()
+}
+
+// RotateContext is Rotate, except that compressing the old log is abandoned if ctx is done first, leaving it
+// uncompressed. The error wraps ctx's.
+func (lm *LogManager) RotateContext(ctx context.Context) (err error) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if lm.shuttingDown || lm.closed {
+		return os.ErrClosed
+	}
+	if !lm.opened {
+		return ErrNotOpen
+	}
+	err = ctx.Err()
+	if err != nil {
+		return
+	}
+	if lm.debounced() {
+		return nil
+	}
+	lm.rotateCtx = ctx
+	defer func() { lm.rotateCtx = nil }()
+
+	return lm.rotate()
+}
+
+// createPending is a helper function that creates the log file LazyCreate put off, if it hasn't been already.
+// Closed log managers have nothing pending. The lock must already be held.
+func (lm *LogManager) createPending() error {
+	if !lm.pending {
+		return nil
+	}
+	return lm.rotate()
+}
+
+// debounced is a helper function that checks if a rotation that's been asked for comes within RotateDebounce of the
+// last one, and should be left to it instead. The lock must already be held.
+func (lm *LogManager) debounced() bool {
+	return lm.options.RotateDebounce > 0 && lm.currentFile != nil && lm.options.Now().Sub(lm.lastRotation) < lm.options.RotateDebounce
+}
+
+// rotate is a helper function that performs a rotation. The lock must already be held.
+func (lm *LogManager) rotate() (err error) {
+	start := time.Now()
+	started := lm.lastRotation // When the file we're rotating away from was started
 	var newFn string
 
+	// Rotating needs the old file open, to mark, close, and archive it
+	err = lm.wake()
+	if err != nil {
+		return
+	}
+
+	rotated := lm.options.Now()
 	lt := &LogTemplate{
-		Time:      time.Now(),
+		Time:      lm.filenameTime(),
 		Iteration: 0,
 	}
 
+	// Let the template know which file we're rotating away from
+	if lm.currentFile != nil {
+		lt.Previous, err = filepath.Rel(lm.options.Dir, lm.currentFile.Name())
+		if err != nil {
+			lt.Previous = filepath.Base(lm.currentFile.Name())
+		}
+	}
+
 	// Get correct iteration by checking for existing files
-	// Start at 0, generate a filename, check if it exists, if it does, increment and try again
+	// Start after the highest iteration in use, generate a filename, check if it exists, if it does, increment and try again
+	// Shifted and FIFO files always keep the same name, and the collision resolver comes up with its own names
+	if !lm.options.ShiftMode && !lm.options.FIFO && lm.options.CollisionResolver == nil {
+		lt.Iteration = lm.firstIteration(*lt)
+		if lt.Iteration > lm.options.MaxIteration {
+			return fmt.Errorf("unable to find an unused filename after %d iterations", lt.Iteration)
+		}
+	}
 	var oldFn string // Check to make sure that the file names are different, otherwise we'll get an infinite loop
+	var base string  // The filename without any iterations, for the collision resolver
 	for {
 		// Get the file's potential filename
-		buf := new(bytes.Buffer)
-		err = lm.templater.Execute(buf, lt)
+		var name string
+		if lm.options.CollisionResolver != nil && lt.Iteration > 0 {
+			lm.hook(func() { name = lm.options.CollisionResolver(base, lt.Iteration) })
+		} else {
+			buf := new(bytes.Buffer)
+			err = lm.templater.Execute(buf, lt)
+			if err != nil {
+				return fmt.Errorf("error executing template: %s", err)
+			}
+			name = buf.String()
+			base = name
+		}
+		err = checkFilename(name)
 		if err != nil {
-			return fmt.Errorf("error executing template: %s", err)
+			return
+		}
+		newFn = filepath.Join(lm.options.Dir, name)
+
+		// In shift mode the active file always keeps its name, old files get renamed out of the way instead
+		// A FIFO also always keeps its name, since it's just reopened
+		if lm.options.ShiftMode || lm.options.FIFO {
+			break
 		}
-		newFn = filepath.Join(lm.options.Dir, buf.String())
 
 		// Check if filename is different from old filename, otherwise return nothing, keep current file
 		if oldFn == newFn {
@@ -72,47 +339,164 @@ func (lm *LogManager) Rotate() (err error) {
 		}
 		oldFn = newFn
 
-		// Check if the file exists
-		if _, err := os.Stat(newFn); errors.Is(err, os.ErrNotExist) {
+		// Check if the file exists, in any form, so we don't end up overwriting an old archive of it later
+		used, err := lm.inUse(newFn)
+		if err != nil {
+			return err
+		}
+		if !used {
 			break
-		} else if err != nil {
-			return fmt.Errorf("unable to stat file: %w", err)
 		}
 
-		// If it does exist, increment the count and try again
+		// If it does exist, increment the count and try again, unless we've run out of iterations
+		if lt.Iteration >= lm.options.MaxIteration {
+			return fmt.Errorf("unable to find an unused filename after %d iterations", lt.Iteration+1)
+		}
 		lt.Iteration++
 	}
 
-	if lm.currentFile != nil {
-		// Close the old log file
-		err = lm.currentFile.Close()
+	// A log that's compressed as it's written is named like the archive it already is
+	if lm.streaming() {
+		newFn = newFn + CompressGzip.ext()
+	}
+
+	// In dry run mode, only report what we would've done
+	if lm.options.DryRun && lm.currentFile != nil {
+		lm.reportDryRun(newFn)
+		lm.lastRotation = lm.options.Now()
+		lm.writes = 0
+		lm.pending = false
+		lm.noteBurst()
+		return
+	}
+
+	// Don't start a new file on a disk that's about to fill up, keep using the old one instead
+	if lm.options.MinFreeBytes > 0 && lm.currentFile != nil && !lm.options.FIFO {
+		err = lm.checkFreeSpace()
 		if err != nil {
 			return
 		}
+	}
+
+	// Open the new log file before touching the old one, so the old one can still be used if that fails
+	// Shifted files take over the old one's name, and a FIFO is just reopened, so those have to wait until it's out of the way
+	var newFile *os.File
+	openFirst := !lm.options.ShiftMode && !lm.options.FIFO
+	if openFirst {
+		newFile, err = lm.openWithRetries(newFn)
+		if err != nil {
+			return fmt.Errorf("unable to open new log file: %w", err)
+		}
+	}
+
+	oldFile := lm.currentFile
+	var shifted string // Where ShiftMode moved the old log file to
+	if oldFile != nil {
+		// Finish off the last line, before anything else is added
+		if lm.options.EnsureTrailingNewline {
+			err = lm.ensureTrailingNewline()
+			if err != nil {
+				discard(newFile)
+				return
+			}
+		}
 
-		// Compress the old log file
-		if lm.options.GZIP {
-			// This won't throw an error if the file is empty(?), but it won't create a gzip file
-			err = compress(lm.currentFile.Name())
+		// Mark the end of the old log file
+		if lm.marker != nil {
+			err = lm.writeMarker(lt)
 			if err != nil {
-				return fmt.Errorf("unable to compress file: %w", err)
+				discard(newFile)
+				return
 			}
+		}
 
-			err = os.Remove(lm.currentFile.Name())
+		// Shift the old log file out of the way and start the new one in its place, the same way a RotatingFile does,
+		// the rest of the archiving can wait until the new one is ready. If that fails, the old one is put back, and
+		// treated like an idle file, so the next write tries to reopen it.
+		if lm.options.ShiftMode {
+			rf := lm.shifter(oldFile)
+			shifted, err = rf.rotate()
+			if err != nil {
+				lm.idle = true
+				return fmt.Errorf("unable to shift old logs: %w", err)
+			}
+			newFile = rf.f
+		} else {
+			// Close the old log file
+			err = lm.closeFile(oldFile)
 			if err != nil {
-				return fmt.Errorf("unable to old log: %w", err)
+				discard(newFile)
+				return
 			}
 		}
 	}
 
-	// New log file
-	lm.currentFile, err = os.OpenFile(newFn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	// New log file, unless it's already been opened
+	switch {
+	case openFirst, newFile != nil:
+	case lm.options.FIFO:
+		newFile, err = openFIFO(newFn)
+	default:
+		newFile, err = lm.openWithRetries(newFn)
+	}
 	if err != nil {
+		switch {
+		case lm.options.FIFO:
+			// The next write tries to reopen it, once there's a reader
+			lm.currentFile = nil
+		case oldFile != nil:
+			// Treat the old log file like an idle file, so the next write tries to reopen it
+			lm.idle = true
+		}
 		return fmt.Errorf("unable to open new log file: %w", err)
 	}
+	lm.currentFile = newFile
+	fi, err := lm.currentFile.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat new log file: %w", err)
+	}
+	size := fi.Size()
+	fresh := size == 0 && !lm.options.FIFO
+	lm.overhead = 0
+	lm.startStream()
+
+	// Mark brand new files as UTF-8, for consumers that need it
+	if lm.options.WriteBOM && fresh {
+		n, err := lm.writeFile(utf8BOM)
+		size += int64(n)
+		lm.overhead += int64(n)
+		if err != nil {
+			return fmt.Errorf("unable to write BOM: %w", err)
+		}
+	}
+
+	// Start brand new files with the header
+	if lm.options.Header != "" && fresh {
+		n, err := lm.writeFile([]byte(lm.options.Header))
+		size += int64(n)
+		lm.overhead += int64(n)
+		if err != nil {
+			return fmt.Errorf("unable to write header: %w", err)
+		}
+	}
 
 	// Update last rotation time
-	lm.lastRotation = time.Now()
+	lm.lastRotation = lm.options.Now()
+	lm.writes = 0
+	lm.pending = false
+	lm.noteBurst()
+	atomic.AddUint64(&lm.stats.rotations, 1)
+	atomic.StoreInt64(&lm.stats.currentFileSize, size)
+	lm.rotateFollowers()
+	lm.rotateSink()
+
+	// Archive the old log file, now that we've moved on from it
+	if oldFile != nil && !lm.options.FIFO {
+		err = lm.archiveRotated(oldFile.Name(), shifted, started, rotated)
+		if err != nil {
+			return
+		}
+	}
 
 	// Delete old latest.log
 	err = lm.setSymlink()
@@ -120,162 +504,1928 @@ func (lm *LogManager) Rotate() (err error) {
 		return err
 	}
 
-	return
-}
-
-// Write checks all of the log manager's conditions, potentially triggers a rotation, then writes to a corresponding log file
-func (lm *LogManager) Write(p []byte) (n int, err error) {
-	lm.Lock()
-	defer lm.Unlock()
+	lm.currentBase = lm.baseName(lt.Time)
 
-	// Stat the file
-	fi, err := os.Stat(lm.currentFile.Name())
-
-	// Catch any errors
-	if err != nil {
-		// Check if file exists, if it doesn't, create it (might have gotten deleted)
-		if errors.Is(err, os.ErrNotExist) {
-			_, err = os.OpenFile(lm.currentFile.Name(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				return
-			}
-			// Otherwise, return the error
-		} else {
-			err = fmt.Errorf("unable to stat file: %w", err)
+	// Keep track of where the sequence numbers are up to, in case we're restarted
+	if lm.options.SequenceNumbers {
+		err = lm.saveSequence()
+		if err != nil {
 			return
 		}
 	}
 
-	switch {
-	// If we have a configured max file size, check if file + our write is greater than the max file size
-	case lm.options.MaxFileSize > 0 && fi.Size()+int64(len(p)) >= lm.options.MaxFileSize:
-		fallthrough
-	// If we have a configured rotation interval, check if the current time is greater than the last rotation + the rotation interval
-	case lm.options.RotationInterval > 0 && time.Since(lm.lastRotation) > lm.options.RotationInterval:
-		// Unlock the mutex so we can rotate without deadlocking
-		lm.Unlock()
-		err = lm.Rotate()
-		lm.Lock()
+	// Delete old logs we don't need to keep anymore
+	// This has to stay last: if the new file couldn't be opened (e.g. the disk is full), we've already returned,
+	// and the old logs are all still there
+	err = lm.enforceRetention()
+	if err != nil {
+		return fmt.Errorf("unable to remove old logs: %w", err)
+	}
+	err = lm.enforceSampling()
+	if err != nil {
+		return fmt.Errorf("unable to thin out old logs: %w", err)
+	}
+	if g := lm.options.SharedRetention; g != nil {
+		g.update(lm)
+		err = g.enforce(lm.options.Now())
 		if err != nil {
-			return 0, fmt.Errorf("unable to rotate log file: %w", err)
+			return fmt.Errorf("unable to remove old logs: %w", err)
 		}
 	}
 
-	return lm.currentFile.Write(p)
+	lm.recordRotationDuration(time.Since(start))
+
+	return
 }
 
-// setSymlink is a helper function to update/create the "latest" symlink in the log directory
-func (lm *LogManager) setSymlink() (err error) {
-	latestDotLog := filepath.Join(lm.options.Dir, "latest")
-	os.Remove(latestDotLog)
-	if lm.options.LatestDotLog && lm.currentFile != nil {
-		// Create symlink to current log file
-		err = os.Symlink(lm.currentFile.Name(), latestDotLog)
-		if err != nil {
-			return fmt.Errorf("unable to create symlink: %w", err)
+// checkFreeSpace is a helper function that makes sure there's at least MinFreeBytes free in Dir, enforcing retention
+// to make room if there isn't. Platforms that can't tell us how much space is free always pass.
+func (lm *LogManager) checkFreeSpace() error {
+	free, ok, err := lm.fs.FreeSpace(lm.options.Dir)
+	if err != nil {
+		return fmt.Errorf("unable to check free disk space: %w", err)
+	}
+	if !ok || free >= lm.options.MinFreeBytes {
+		return nil
+	}
+
+	// Only what retention would've deleted after the rotation anyway
+	err = lm.enforceRetention()
+	if err != nil {
+		return fmt.Errorf("unable to remove old logs: %w", err)
+	}
+	free, _, err = lm.fs.FreeSpace(lm.options.Dir)
+	if err != nil {
+		return fmt.Errorf("unable to check free disk space: %w", err)
+	}
+	if free < lm.options.MinFreeBytes {
+		return fmt.Errorf("%w: %d bytes free, expected at least %d", ErrLowDiskSpace, free, lm.options.MinFreeBytes)
+	}
+	return nil
+}
+
+// firstIteration is a helper function that returns the iteration to start looking for an unused filename at:
+// StartIteration, or one past the highest iteration already in the log directory for this filename, whichever is higher
+func (lm *LogManager) firstIteration(lt LogTemplate) uint {
+	first := lm.options.StartIteration
+
+	// Render the filename with two different iterations, whatever's different between them is where the iteration goes
+	lt.Iteration = 0
+	zero := lm.render(&lt)
+	lt.Iteration = 1
+	one := lm.render(&lt)
+	if zero == "" || zero == one || filepath.Dir(zero) != filepath.Dir(one) {
+		return first
+	}
+	a, b := filepath.Base(zero), filepath.Base(one)
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	j := 0
+	for j < len(a)-i && j < len(b)-i && a[len(a)-1-j] == b[len(b)-1-j] {
+		j++
+	}
+	prefix, suffix := a[:i], a[len(a)-j:]
+
+	entries, err := os.ReadDir(filepath.Join(lm.options.Dir, filepath.Dir(zero)))
+	if err != nil {
+		return first
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		n, err := strconv.ParseUint(name[len(prefix):len(name)-len(suffix)], 10, 0)
+		if err == nil && uint(n) >= first {
+			first = uint(n) + 1
 		}
 	}
 
-	return
+	return first
 }
 
-// Create a new LogManager. `timeFormat` is the format used in `filenameFormat`. `filenameFormat` is a template string for type LogNameTemplate.
-func NewLogManager(options LogManagerOptions) *LogManager {
-	lm := LogManager{options: options}
+// render is a helper function that renders the filename for lt, returning an empty string if the template fails
+func (lm *LogManager) render(lt *LogTemplate) string {
+	buf := new(bytes.Buffer)
+	err := lm.templater.Execute(buf, lt)
+	if err != nil {
+		return ""
+	}
+	return buf.String()
+}
 
-	// Check if the directory exists and create it if it doesn't
-	options.Dir = filepath.Clean(options.Dir)
-	_, err := os.Stat(options.Dir)
-	if os.IsNotExist(err) {
-		os.Mkdir(options.Dir, 0755)
+// discard is a helper function that closes and removes a new log file that ended up not being used
+func discard(f *os.File) {
+	if f != nil {
+		f.Close()
+		os.Remove(f.Name())
 	}
+}
 
-	// Check if filename format is set, otherwise use default
-	if options.FilenameFormat == "" {
-		options.FilenameFormat = `{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log`
+// ensureTrailingNewline is a helper function that ends the current file with a newline, if it doesn't already end with
+// one. The lock must already be held, and the file open.
+func (lm *LogManager) ensureTrailingNewline() error {
+	if lm.stream != nil {
+		return lm.streamTrailingNewline()
+	}
+	size := atomic.LoadInt64(&lm.stats.currentFileSize)
+	if size <= 0 || lm.options.FIFO {
+		return nil
 	}
 
-	// Validate template string
-	lm.templater, err = template.New("").Parse(options.FilenameFormat)
+	// The current file's only open for writing
+	f, err := os.Open(lm.currentFile.Name())
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("unable to check for a trailing newline: %w", err)
+	}
+	defer f.Close()
+	last := make([]byte, 1)
+	_, err = f.ReadAt(last, size-1)
+	if err != nil {
+		return fmt.Errorf("unable to check for a trailing newline: %w", err)
+	}
+	if last[0] == '\n' {
+		return nil
 	}
 
-	// If latest.log exists, but options.LatestDotLog is false, remove it
-	latestDotLog := filepath.Join(options.Dir, "latest.log")
-	os.Remove(latestDotLog)
-	if !options.LatestDotLog {
-		latestDotLog = filepath.Join(options.Dir, "latest")
-		os.Remove(latestDotLog)
+	n, err := lm.currentFile.Write([]byte("\n"))
+	atomic.AddInt64(&lm.stats.currentFileSize, int64(n))
+	if err != nil {
+		return fmt.Errorf("unable to write trailing newline: %w", err)
 	}
+	return nil
+}
 
-	// Read all files in the directory, find the latest one
-	var newestFile *os.FileInfo
-	filepath.Walk(options.Dir, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() || info.Name() == "latest" || info.Name() == "latest.log" || strings.HasSuffix(info.Name(), ".tar.gz") {
-			return nil
+// writeMarker appends the rendered RotationMarker to the current file, as its own line
+func (lm *LogManager) writeMarker(lt *LogTemplate) error {
+	buf := new(bytes.Buffer)
+	err := lm.marker.Execute(buf, lt)
+	if err != nil {
+		return fmt.Errorf("unable to execute rotation marker template: %w", err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	_, err = lm.writeFile(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("unable to write rotation marker: %w", err)
+	}
+	return nil
+}
+
+// openWithRetries is a helper function that opens a new log file, retrying up to RotateRetries times if it fails.
+// The wait between attempts starts at RotateBackoff and doubles each time. Permanent errors aren't retried.
+func (lm *LogManager) openWithRetries(name string) (f *os.File, err error) {
+	backoff := lm.options.RotateBackoff
+	for attempt := 0; ; attempt++ {
+		f, err = lm.fs.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil || attempt >= lm.options.RotateRetries || isPermanent(err) {
+			return
 		}
 
-		if newestFile == nil || info.ModTime().After((*newestFile).ModTime()) {
-			newestFile = &info
+		lm.logf("unable to open %s, retrying in %s: %s", name, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isPermanent is a helper function that reports whether an error opening a file isn't worth retrying
+func isPermanent(err error) bool {
+	return errors.Is(err, os.ErrPermission)
+}
+
+// archiveRotated is a helper function that compresses and/or records a log file that was just rotated away from. In
+// ShiftMode, it's already been shifted to shifted.
+func (lm *LogManager) archiveRotated(closedFn, shifted string, started, rotated time.Time) (err error) {
+	// A file we adopted wasn't ours to begin with, so it's only compressed if we've been asked to
+	// A stream is already compressed
+	compress := lm.options.GZIP && !lm.streaming() && (closedFn != lm.adopted || lm.options.CompressAdopted)
+	if closedFn == lm.adopted {
+		lm.adopted = ""
+	}
+
+	if shifted != "" {
+		closedFn = shifted
+	}
+
+	// Move the old log file into the partition for when it was started
+	// Shifted logs are renamed on every rotation, so they stay where they are
+	if lm.options.PartitionBy != PartitionNone && !lm.options.ShiftMode {
+		if started.IsZero() {
+			started = rotated
+		}
+		closedFn, err = lm.partition(closedFn, started)
+		if err != nil {
+			return fmt.Errorf("unable to partition old log: %w", err)
 		}
+	}
+	archiveFn := lm.archivePath(closedFn)
 
-		return nil
-	})
+	// Compress the old log file in the background, if we've been asked to
+	// Shifting renames old logs on every rotation, so it can't be done while a compression is still running
+	if compress && lm.options.AsyncCompress && !lm.options.ShiftMode {
+		lm.workers.Add(1)
+		atomic.AddInt64(&lm.compressing, 1)
+		lm.inFlight.Store(closedFn, true)
+		go lm.compressInBackground(closedFn, archiveFn, rotated)
+		return
+	}
 
-	if newestFile == nil {
-		// If there is no newest file, create one
-		lm.Rotate()
-	} else {
-		// Otherwise, open it
-		lm.currentFile, err = os.OpenFile(filepath.Join(options.Dir, (*newestFile).Name()), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	// Compress the old log file
+	if compress {
+		err = lm.compressOld(closedFn, archiveFn, true)
 		if err != nil {
-			panic(err)
+			return err
 		}
+		closedFn = archiveFn
 	}
 
-	// Set symlink
-	err = lm.setSymlink()
+	// Add the old log file to the manifest
+	if lm.options.WriteManifest {
+		err = lm.recordRotation(closedFn, rotated)
+		if err != nil {
+			return fmt.Errorf("unable to update manifest: %w", err)
+		}
+	}
+
+	return
+}
+
+// compressOld is a helper function that compresses a rotated log file into archiveFn, then removes it.
+// AfterCompress is called with the result, as a hook if the lock is held.
+func (lm *LogManager) compressOld(closedFn, archiveFn string, locked bool) (err error) {
+	defer func() {
+		if lm.options.AfterCompress == nil {
+			return
+		}
+		if locked {
+			lm.hook(func() { lm.options.AfterCompress(archiveFn, err) })
+		} else {
+			lm.options.AfterCompress(archiveFn, err)
+		}
+	}()
+
+	err = os.MkdirAll(filepath.Dir(archiveFn), 0755)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("unable to create archive directory: %w", err)
 	}
 
-	if options.RotationInterval != 0 {
-		if newestFile != nil {
-			// Since we have a rotation interval, we can accurately estimate the time of the last rotation
-			// We'll look at the modtime of the current file and truncate it to the nearest rotation interval (floor, basically)
-			lm.lastRotation = (*newestFile).ModTime().Truncate(options.RotationInterval)
+	// This won't throw an error if the file is empty(?), but it won't create a gzip file
+	// Only a compression that's part of a rotation can be cancelled
+	ctx := context.Background()
+	if locked && lm.rotateCtx != nil {
+		ctx = lm.rotateCtx
+	}
+	err = lm.compressor(ctx, closedFn, archiveFn)
+	if err != nil {
+		atomic.AddUint64(&lm.stats.compressionErrors, 1)
+		return fmt.Errorf("unable to compress file: %w", err)
+	}
+
+	// Describe the archive, while we've still got the original to look at
+	if lm.options.WriteArchiveMeta {
+		err = lm.writeArchiveMeta(closedFn, archiveFn)
+		if err != nil {
+			return fmt.Errorf("unable to write archive metadata: %w", err)
 		}
 	}
 
-	return &lm
+	err = lm.removeOriginal(closedFn)
+	if err != nil {
+		return
+	}
+
+	lm.upload(archiveFn)
+	return
 }
 
-// compress is a helper function to gzip a file
-func compress(filename string) (err error) {
-	// Prevent compressing a file that's already compressed
-	if strings.HasSuffix(filename, ".tar.gz") {
-		return
+// removeOriginal is a helper function that removes a log once it's been compressed, or once DeleteDelay has passed (or
+// the log manager's closed) in the background.
+func (lm *LogManager) removeOriginal(closedFn string) error {
+	delay, logger := lm.options.DeleteDelay, lm.options.Logger
+	if delay <= 0 {
+		defer lm.inFlight.Delete(closedFn)
+		err := os.Remove(closedFn)
+		if err != nil {
+			return fmt.Errorf("unable to remove old log: %w", err)
+		}
+		return nil
 	}
 
-	// Referenced from https://www.arthurkoziel.com/writing-tar-gz-files-in-go/
+	// Until it's gone, it isn't a backup of its own, its archive is
+	lm.inFlight.Store(closedFn, true)
+	lm.workers.Add(1)
+	go func() {
+		defer lm.workers.Done()
+		defer lm.inFlight.Delete(closedFn)
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-lm.closing:
+		}
+
+		// Retention might've got to it first, or someone else
+		err := os.Remove(closedFn)
+		if err != nil && !os.IsNotExist(err) && logger != nil {
+			logger.Printf("unable to remove old log: %s", err)
+		}
+	}()
+	return nil
+}
+
+// compressInBackground is a helper function that runs compressOld on a worker goroutine, reporting errors to the logger
+func (lm *LogManager) compressInBackground(closedFn, archiveFn string, rotated time.Time) {
+	defer lm.workers.Done()
+	defer atomic.AddInt64(&lm.compressing, -1)
+
+	err := lm.compressOld(closedFn, archiveFn, false)
+
+	lm.Lock()
+	defer lm.Unlock()
 
-	// Create writer for our destination archive
-	buf, err := os.Create(filepath.Join(filepath.Dir(filename), strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))) + ".tar.gz")
 	if err != nil {
+		// It's staying as it is, so it's a backup like any other
+		lm.inFlight.Delete(closedFn)
+		lm.logf("unable to compress %s in the background: %s", closedFn, err)
 		return
 	}
 
-	gw := gzip.NewWriter(buf)
-	defer gw.Close()
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
+	// Add the archive to the manifest
+	if lm.options.WriteManifest {
+		err = lm.recordRotation(archiveFn, rotated)
+		if err != nil {
+			lm.logf("unable to update manifest: %s", err)
+		}
+	}
+}
+
+// reportDryRun is a helper function that logs the actions a rotation to newFn would take
+func (lm *LogManager) reportDryRun(newFn string) {
+	closedFn := lm.currentFile.Name()
+
+	if lm.options.ShiftMode {
+		lm.logf("dry run: would shift %s to %s.1", closedFn, closedFn)
+		closedFn += ".1"
+	}
+	archiveFn := lm.archivePath(closedFn)
+	if lm.options.GZIP {
+		lm.logf("dry run: would compress %s to %s", closedFn, archiveFn)
+		closedFn = archiveFn
+	}
+	if lm.options.WriteManifest {
+		lm.logf("dry run: would add %s to manifest", closedFn)
+	}
+	lm.logf("dry run: would rotate to %s", newFn)
+}
+
+// logf is a helper function that reports the log manager's own messages to the configured logger, if any
+func (lm *LogManager) logf(format string, v ...any) {
+	if lm.options.Logger != nil {
+		lm.hook(func() { lm.options.Logger.Printf(format, v...) })
+	}
+}
+
+// Write checks all of the log manager's conditions, potentially triggers a rotation, then writes to a corresponding log file
+func (lm *LogManager) Write(p []byte) (n int, err error) {
+	// Leave the actual writing to the background, if we've been asked to
+	if queued, err := lm.enqueue([][]byte{p}); queued {
+		if err != nil {
+			lm.drop(p, err)
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	n, err = lm.writeLocked(p)
+	if err != nil {
+		lm.drop(p[n:], err)
+	}
+	return
+}
+
+// writeLocked is a helper function that does the work of Write, holding the lock for it
+func (lm *LogManager) writeLocked(p []byte) (n int, err error) {
+	err = lm.lockWrite()
+	if err != nil {
+		return
+	}
+	defer lm.Unlock()
+
+	size, err := lm.statCurrent()
+	if err != nil {
+		return
+	}
+
+	return lm.write(size, p)
+}
+
+// WriteAll writes each of lines, taking the lock and checking on the current file only once for the whole batch.
+// Rotations are still checked for before each line, so a batch can be split across multiple files.
+func (lm *LogManager) WriteAll(lines [][]byte) (n int, err error) {
+	// Leave the actual writing to the background, if we've been asked to
+	if queued, err := lm.enqueue(lines); queued {
+		if err != nil {
+			for _, line := range lines {
+				lm.drop(line, err)
+			}
+			return 0, err
+		}
+		for _, line := range lines {
+			n += len(line)
+		}
+		return n, nil
+	}
+
+	return lm.writeAll(lines)
+}
+
+// writeAll is a helper function that does the work of WriteAll, passing anything that couldn't be written to OnDrop
+func (lm *LogManager) writeAll(lines [][]byte) (n int, err error) {
+	n, i, written, err := lm.writeAllLocked(lines)
+	if err != nil && i < len(lines) {
+		// Everything from the line that failed onwards was dropped
+		lm.drop(lines[i][written:], err)
+		for _, line := range lines[i+1:] {
+			lm.drop(line, err)
+		}
+	}
+	return
+}
+
+// writeAllLocked is a helper function that does the work of WriteAll, holding the lock for it.
+// If it fails, i is the line it failed on, and written is how much of that line was written.
+func (lm *LogManager) writeAllLocked(lines [][]byte) (n, i, written int, err error) {
+	err = lm.lockWrite()
+	if err != nil {
+		return
+	}
+	defer lm.Unlock()
+
+	size, err := lm.statCurrent()
+	if err != nil {
+		return
+	}
+
+	for i = range lines {
+		written, err = lm.write(size, lines[i])
+		n += written
+		if err != nil {
+			return
+		}
+		size = atomic.LoadInt64(&lm.stats.currentFileSize)
+	}
+
+	return
+}
+
+// AppendRaw writes p straight to the current log file, without rotating first or adding anything to it, for callers
+// that call Rotate() on their own schedule.
+func (lm *LogManager) AppendRaw(p []byte) (n int, err error) {
+	n, err = lm.appendRawLocked(p)
+	if err != nil {
+		lm.drop(p[n:], err)
+	}
+	return
+}
+
+// appendRawLocked is a helper function that does the work of AppendRaw, holding the lock for it
+func (lm *LogManager) appendRawLocked(p []byte) (n int, err error) {
+	err = lm.lockWrite()
+	if err != nil {
+		return
+	}
+	defer lm.Unlock()
+
+	err = lm.wake()
+	if err != nil {
+		return
+	}
+	err = lm.createPending()
+	if err != nil {
+		return
+	}
+	if lm.currentFile == nil {
+		return 0, errors.New("no log file is open")
+	}
+
+	return lm.writeCurrent(atomic.LoadInt64(&lm.stats.currentFileSize), p)
+}
+
+// drop is a helper function that hands p to OnDrop, if it's set, after a write of it failed with err.
+// The lock must not be held, so OnDrop is free to log elsewhere, or even to retry.
+func (lm *LogManager) drop(p []byte, err error) {
+	onDrop, _ := lm.onDrop.Load().(func([]byte, error))
+	if onDrop != nil && len(p) > 0 {
+		onDrop(p, err)
+	}
+}
+
+// StdLogger returns a *log.Logger that writes through lm, with the given prefix and flags (see [log.New]).
+// Pass log.LstdFlags to timestamp each line.
+func (lm *LogManager) StdLogger(prefix string, flags int) *log.Logger {
+	return log.New(lm, prefix, flags)
+}
+
+// lockWrite is a helper function that takes the lock for a write, giving up after WriteTimeout if it's set.
+// Once Close has started, it returns os.ErrClosed instead, without holding the lock.
+func (lm *LogManager) lockWrite() error {
+	// A hook writing to us would wait on the lock forever, since we're holding it while it runs
+	if lm.inHook() {
+		return ErrReentrantWrite
+	}
+
+	// If we have a configured write timeout, don't wait on a slow rotation any longer than that
+	if timeout := time.Duration(atomic.LoadInt64(&lm.writeTimeout)); timeout > 0 {
+		if !lm.lockTimeout(timeout) {
+			return ErrWriteTimeout
+		}
+	} else {
+		lm.Lock()
+	}
+
+	if lm.shuttingDown {
+		lm.Unlock()
+		return os.ErrClosed
+	}
+	if !lm.opened {
+		lm.Unlock()
+		return ErrNotOpen
+	}
+	return nil
+}
+
+// statCurrent is a helper function that returns the size of the current log file, recreating it if it's been deleted
+func (lm *LogManager) statCurrent() (size int64, err error) {
+	// Reopen the file if it was closed for being idle
+	err = lm.wake()
+	if err != nil {
+		return 0, err
+	}
+
+	// A FIFO gets closed once its reader goes away, so try to reopen it
+	// With LazyCreate, the first write creates its file (header and all) before it's written itself
+	if lm.currentFile == nil && lm.options.FIFO || lm.pending {
+		err = lm.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Size the file we have open, rather than whatever its name leads to, unless its name no longer leads to it
+	name := lm.currentFile.Name()
+	fi, err := lm.currentFile.Stat()
+	named, statErr := os.Stat(name)
+	switch {
+	case err != nil && statErr == nil:
+		// Fall back to its name if what we have open can't be checked
+		return named.Size(), nil
+	case statErr == nil && os.SameFile(fi, named):
+		return fi.Size(), nil
+	case statErr != nil && !errors.Is(statErr, os.ErrNotExist):
+		return 0, fmt.Errorf("unable to stat file: %w", statErr)
+	}
+
+	// It's been deleted or replaced from under us, so carry on at its name, creating it if it has to be
+	lm.logf("%s was deleted or replaced, reopening it", name)
+	f, err := lm.fs.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("unable to reopen log file: %w", err)
+	}
+	lm.currentFile.Close()
+	lm.currentFile = f
+	lm.startStream()
+
+	fi, err = f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("unable to stat file: %w", err)
+	}
+	return fi.Size(), nil
+}
+
+// write is a helper function that rotates if writing p to a current file of the given size calls for it, then writes p.
+// The lock must already be held.
+func (lm *LogManager) write(size int64, p []byte) (n int, err error) {
+	// Number each write, and count the number towards the file's size too
+	if lm.options.SequenceNumbers {
+		prefix := lm.nextSequence()
+		n, err = lm.writeRecord(size, append(prefix, p...), len(prefix))
+		if n > 0 {
+			lm.overhead += int64(len(prefix))
+		}
+		n -= len(prefix)
+		if n < 0 {
+			n = 0
+		}
+		return
+	}
+
+	return lm.writeRecord(size, p, 0)
+}
+
+// writeRecord is a helper function that does the work of write, once p is ready to be written as-is.
+// The first prefix bytes of p were added by us. The lock must already be held.
+func (lm *LogManager) writeRecord(size int64, p []byte, prefix int) (n int, err error) {
+	// Check if this write could never fit in a single file
+	if lm.options.MaxFileSize > 0 && !lm.options.FIFO && int64(len(p)) > lm.options.MaxFileSize {
+		switch lm.options.OversizedWrites {
+		case OversizeReject:
+			return 0, ErrWriteTooLarge
+		case OversizeSplit:
+			return lm.writeSplit(size, p)
+		}
+	}
+
+	// Only count what's been written to us, if we've been asked to
+	counted := size
+	if lm.options.ExcludeOverhead {
+		counted -= lm.overhead + int64(prefix)
+	}
+
+	// Keep a file that's had nothing written to it for another interval, instead of leaving an empty file behind
+	if lm.options.SkipEmptyRotation && size <= lm.overhead && lm.rotationDue() {
+		lm.lastRotation = lm.options.Now()
+	}
+
+	if lm.shouldRotate(counted, p) {
+		err = lm.rotate()
+		switch {
+		case errors.Is(err, ErrLowDiskSpace):
+			// Starting a new file wouldn't help, so carry on in this one until there's room
+			lm.logf("unable to rotate log file: %s", err)
+		case err != nil:
+			return 0, fmt.Errorf("unable to rotate log file: %w", err)
+		}
+		size = atomic.LoadInt64(&lm.stats.currentFileSize)
+	}
+
+	return lm.writeCurrent(size, p)
+}
+
+// writeSplit is a helper function that writes p across as many files as it takes to keep each of them within MaxFileSize,
+// starting with whatever room is left in the current file. The lock must already be held.
+func (lm *LogManager) writeSplit(size int64, p []byte) (n int, err error) {
+	for len(p) > 0 {
+		// Start a new file once this one is full
+		if size >= lm.options.MaxFileSize {
+			old := lm.currentFile.Name()
+			err = lm.rotate()
+			if err != nil {
+				return n, fmt.Errorf("unable to rotate log file: %w", err)
+			}
+			if lm.currentFile.Name() == old {
+				return n, fmt.Errorf("unable to split write, rotating didn't start a new file")
+			}
+			size = atomic.LoadInt64(&lm.stats.currentFileSize)
+		}
+
+		chunk := p
+		if room := lm.options.MaxFileSize - size; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+
+		var written int
+		written, err = lm.writeCurrent(size, chunk)
+		n += written
+		if err != nil {
+			return
+		}
+		size += int64(written)
+		p = p[written:]
+	}
+
+	return
+}
+
+// writeCurrent is a helper function that writes p to the current file of the given size, without checking for rotations.
+// The lock must already be held.
+func (lm *LogManager) writeCurrent(size int64, p []byte) (n int, err error) {
+	n, err = lm.writeFile(p)
+	lm.writes++
+	lm.lastWrite = lm.options.Now()
+	lm.armIdleTimer()
+	atomic.AddUint64(&lm.stats.bytesWritten, uint64(n))
+	atomic.StoreInt64(&lm.stats.currentFileSize, size+int64(n))
+	lm.recordWrite(n)
+	if lm.stream != nil {
+		lm.streamSize()
+	}
+	if err != nil {
+		// The FIFO's reader went away, reopen it on the next write
+		if lm.options.FIFO && isBrokenPipe(err) {
+			lm.currentFile.Close()
+			lm.currentFile = nil
+		}
+		return
+	}
+
+	if lm.syslog != nil {
+		lm.syslog.tee(p[:n])
+	}
+	lm.wakeFollowers(false)
+
+	// Keep the copy of the latest log up to date
+	if lm.latestFile != nil {
+		_, err = lm.latestFile.Write(p[:n])
+		if err != nil {
+			err = fmt.Errorf("unable to update latest: %w", err)
+		}
+	}
+
+	if len(lm.tees) > 0 {
+		teeErr := lm.tee(p[:n])
+		if err == nil {
+			err = teeErr
+		}
+	}
+
+	if lm.options.WriterFactory != nil {
+		sinkErr := lm.writeSink(p[:n])
+		if err == nil {
+			err = sinkErr
+		}
+	}
+
+	return
+}
+
+// filenameTime is a helper function that returns the time to render filenames with: FilenameTimeFunc's if it's set,
+// otherwise the same clock as rotations
+func (lm *LogManager) filenameTime() time.Time {
+	if lm.options.FilenameTimeFunc != nil {
+		var t time.Time
+		lm.hook(func() { t = lm.options.FilenameTimeFunc() })
+		return t
+	}
+	return lm.options.Now()
+}
+
+// baseName is a helper function that renders the filename for time t, without any iterations. It returns an empty string if the template fails.
+func (lm *LogManager) baseName(t time.Time) string {
+	return lm.render(&LogTemplate{Time: t})
+}
+
+// shouldRotate is a helper function that checks the log manager's conditions, to see if writing p to a file of the given size should trigger a rotation
+func (lm *LogManager) shouldRotate(size int64, p []byte) bool {
+	switch {
+	// If we're debouncing, nothing can rotate again so soon, it's left to the rotation that just happened
+	case lm.debounced():
+		return false
+	// If we're rotating on an interval or a calendar schedule, check if it's time
+	case lm.rotationDue():
+		return true
+	// If we've rotated too recently, hold off whatever else is asking for it, and carry on in the current file
+	case lm.options.MinRotationInterval > 0 && lm.options.Now().Sub(lm.lastRotation) < lm.options.MinRotationInterval:
+		return false
+	// If we have a configured max file size, check if file + our write is greater than the max file size
+	// Don't rotate a file smaller than the min file size though, otherwise big writes would leave a trail of empty files
+	// A FIFO has no size, so it's never rotated by size, and neither is anything written during the startup grace period
+	case lm.options.MaxFileSize > 0 && !lm.options.FIFO && size+int64(len(p)) >= lm.options.MaxFileSize && size >= lm.options.MinFileSize &&
+		lm.options.Now().Sub(lm.started) >= lm.options.StartupGrace:
+		return true
+	// If we have a configured max number of writes, check if the current file has had that many already
+	case lm.options.MaxWrites > 0 && lm.writes >= lm.options.MaxWrites:
+		return true
+	// If we're keeping filenames in sync with the time, check if the current file would have a different name by now
+	case lm.options.RotateOnNameChange && lm.baseName(lm.filenameTime()) != lm.currentBase:
+		return true
+	// If we're splitting out bursts, check if one's just started
+	case lm.options.BurstRate > 0 && lm.burstStarted():
+		return true
+	// If we've been given our own policy, check with it last
+	case lm.options.ShouldRotate != nil:
+		var rotate bool
+		lm.hook(func() { rotate = lm.options.ShouldRotate(size, lm.options.Now().Sub(lm.lastRotation), p) })
+		return rotate
+	}
+
+	return false
+}
+
+// rotationDue is a helper function that checks if the current file has been open for longer than the rotation interval,
+// or has passed the next boundary of the rotation schedule. The lock must already be held.
+func (lm *LogManager) rotationDue() bool {
+	if lm.options.RotationInterval > 0 && lm.options.Now().Sub(lm.lastRotation) > lm.options.RotationInterval {
+		return true
+	}
+	return lm.options.RotationSchedule != RotateNone && !lm.options.Now().Before(lm.options.RotationSchedule.next(lm.lastRotation))
+}
+
+// CurrentFilename returns the path of the log file currently being written to, or "" once the log manager is closed
+func (lm *LogManager) CurrentFilename() string {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if lm.currentFile == nil {
+		return ""
+	}
+	return lm.currentFile.Name()
+}
+
+// Sync commits the current log file to disk
+func (lm *LogManager) Sync() (err error) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	// An idle file was already flushed when it was closed
+	if lm.currentFile == nil || lm.idle {
+		return
+	}
+
+	return lm.flushCurrent()
+}
+
+// flushCurrent is a helper function that gets everything written so far into the current file, compressing whatever's
+// waiting in its gzip stream first. The lock must already be held.
+func (lm *LogManager) flushCurrent() error {
+	if lm.stream != nil {
+		err := lm.stream.Flush()
+		if err != nil {
+			return fmt.Errorf("unable to flush compressed stream: %w", err)
+		}
+		lm.streamSize()
+	}
+
+	err := lm.fs.Sync(lm.currentFile)
+	if err != nil {
+		return fmt.Errorf("unable to sync log file: %w", err)
+	}
+	return nil
+}
+
+// Snapshot copies the current log file to destPath, without rotating it. Logging waits until the copy is done,
+// so the snapshot is a consistent point-in-time copy.
+func (lm *LogManager) Snapshot(destPath string) (err error) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if lm.currentFile == nil {
+		return fmt.Errorf("unable to snapshot, there's no current log file")
+	}
+
+	// Make sure everything written so far is in the file
+	if !lm.idle {
+		err = lm.flushCurrent()
+		if err != nil {
+			return
+		}
+	}
+
+	// Read it back separately, so the append position is left alone
+	src, err := os.Open(lm.currentFile.Name())
+	if err != nil {
+		return fmt.Errorf("unable to open log file: %w", err)
+	}
+	defer src.Close()
+
+	dest, err := os.OpenFile(destPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create snapshot: %w", err)
+	}
+
+	buf := getCopyBuffer(lm.options.CopyBufferSize)
+	defer copyBuffers.Put(buf)
+	err = copyFile(dest, src, *buf)
+	if err != nil {
+		dest.Close()
+		return fmt.Errorf("unable to copy log file: %w", err)
+	}
+
+	err = dest.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close snapshot: %w", err)
+	}
+	return
+}
+
+// WriteTo streams the current log file to w, as it was when WriteTo was called, without rotating it. Logging isn't held
+// up while it's streamed.
+func (lm *LogManager) WriteTo(w io.Writer) (n int64, err error) {
+	src, size, err := lm.openCurrent()
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	buf := getCopyBuffer(lm.options.CopyBufferSize)
+	defer copyBuffers.Put(buf)
+	return io.CopyBuffer(w, io.LimitReader(src, size), *buf)
+}
+
+// openCurrent is a helper function that opens the current log file for reading, separately from the one we're appending
+// to, once everything written so far is in it. It returns how big it was when it was opened.
+func (lm *LogManager) openCurrent() (f *os.File, size int64, err error) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if lm.currentFile == nil {
+		return nil, 0, fmt.Errorf("unable to read log file, there's no current log file")
+	}
+	if !lm.idle {
+		err = lm.flushCurrent()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	f, err = os.Open(lm.currentFile.Name())
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to open log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("unable to stat log file: %w", err)
+	}
+	return f, fi.Size(), nil
+}
+
+// Healthy checks that the log manager can still write logs: that the current log file is open, and that new files can
+// be created in the log directory. It returns what's wrong if not.
+func (lm *LogManager) Healthy() error {
+	lm.Lock()
+	defer lm.Unlock()
+
+	// A log that's waiting on LazyCreate will be created once it's needed, as long as the directory is writable
+	if lm.currentFile == nil && !lm.pending {
+		return fmt.Errorf("no log file is open")
+	}
+	if lm.currentFile != nil && !lm.idle {
+		_, err := lm.currentFile.Stat()
+		if err != nil {
+			return fmt.Errorf("log file is unusable: %w", err)
+		}
+	}
+
+	// Check if the directory is writable (mounted, permissions, space for a new inode), so rotations will work too
+	probe := filepath.Join(lm.options.Dir, ".healthcheck"+lm.options.TempSuffix)
+	f, err := lm.fs.OpenFile(probe, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("log directory is not writable: %w", err)
+	}
+	f.Close()
+	os.Remove(probe)
+
+	return nil
+}
+
+// Options returns the log manager's effective options, with defaults applied
+func (lm *LogManager) Options() LogManagerOptions {
+	lm.Lock()
+	defer lm.Unlock()
+
+	return lm.options
+}
+
+// Reconfigure applies new options to a running log manager, without losing the current log file. Changing Dir,
+// AsyncQueue, or QueueFullPolicy returns an error.
+func (lm *LogManager) Reconfigure(options LogManagerOptions) (err error) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	// Keep the same directory if none was given
+	if options.Dir == "" {
+		options.Dir = lm.options.Dir
+	}
+	options = options.withDefaults()
+	if options.Dir != lm.options.Dir {
+		return fmt.Errorf("unable to change log directory from %s to %s", lm.options.Dir, options.Dir)
+	}
+	// The queue needs the lock to drain, so it can't be swapped out from under it
+	if options.AsyncQueue != lm.options.AsyncQueue || options.QueueFullPolicy != lm.options.QueueFullPolicy {
+		return errors.New("unable to change AsyncQueue or QueueFullPolicy without reopening")
+	}
+
+	// Validate template string before changing anything
+	templater := lm.templater
+	if options.FilenameFormat != lm.options.FilenameFormat {
+		templater, err = template.New("").Parse(options.FilenameFormat)
+		if err != nil {
+			return fmt.Errorf("unable to parse filename format: %w", err)
+		}
+	}
+	marker, err := parseMarker(options.RotationMarker)
+	if err != nil {
+		return fmt.Errorf("unable to parse rotation marker: %w", err)
+	}
+
+	latestChanged := options.LatestDotLog != lm.options.LatestDotLog || options.LatestStrategy != lm.options.LatestStrategy
+	idleChanged := options.CloseWhenIdle != lm.options.CloseWhenIdle
+	syslogChanged := !sameSyslog(options.Syslog, lm.options.Syslog)
+	oldGroup := lm.options.SharedRetention
+
+	lm.options = options
+	lm.templater = templater
+	lm.marker = marker
+	atomic.StoreInt64(&lm.writeTimeout, int64(options.WriteTimeout))
+	lm.onDrop.Store(options.OnDrop)
+	lm.setTees(options.Tee)
+	lm.now.Store(options.Now)
+	atomic.StoreInt64(&lm.stats.rateWindow, int64(options.RateWindow))
+
+	// Start waiting for the new idle period from scratch
+	if idleChanged {
+		lm.stopIdleTimer()
+		if lm.currentFile != nil && !lm.idle {
+			lm.armIdleTimer()
+		}
+	}
+
+	// Swap in a forwarder for the new syslog, and let the old one finish sending what it has in the background
+	if syslogChanged && !lm.closed && !lm.shuttingDown {
+		old := lm.syslog
+		lm.syslog = nil
+		if options.Syslog != nil {
+			lm.syslog = startSyslog(*options.Syslog, options.Logger)
+		}
+		if old != nil {
+			lm.workers.Add(1)
+			go func() {
+				defer lm.workers.Done()
+				old.stop()
+			}()
+		}
+	}
+
+	if options.SharedRetention != oldGroup && !lm.closed {
+		if oldGroup != nil {
+			oldGroup.leave(lm)
+		}
+		if options.SharedRetention != nil {
+			options.SharedRetention.update(lm)
+		}
+	}
+
+	// Recreate latest, in case it's been turned on/off or is kept differently now
+	if latestChanged {
+		err = lm.setSymlink()
+		if err != nil {
+			return err
+		}
+	}
+
+	return
+}
+
+// Close waits for any background compressions, then closes the current log file (bundling old logs, if BundleOnClose
+// is set). Writes that come after it fail with os.ErrClosed.
+func (lm *LogManager) Close() (err error) {
+	// Write out everything that's still queued, and let any background compressions finish first (they need the lock to finish up)
+	// Deletions waiting on DeleteDelay don't need to wait any longer
+	lm.stopQueue()
+
+	// Turn away any writes from here on, so none of them land in a file that's being closed
+	lm.Lock()
+	lm.shuttingDown = true
+	forwarder := lm.syslog
+	lm.syslog = nil
+	lm.Unlock()
+
+	// Nothing else can be queued for syslog now, so let it finish off without holding anything up
+	if forwarder != nil {
+		forwarder.stop()
+	}
+
+	lm.closeOnce.Do(func() {
+		if lm.closing != nil {
+			close(lm.closing)
+		}
+	})
+	lm.workers.Wait()
+
+	lm.Lock()
+	defer lm.Unlock()
+
+	lm.stopIdleTimer()
+	if lm.currentFile == nil && !lm.pending || lm.closed {
+		return
+	}
+	lm.closed = true
+	lm.pending = false
+	// Once everything's done with it (bundling still leaves it out), let go of the current log, however closing goes
+	defer func() { lm.currentFile = nil }()
+	lm.wakeFollowers(true)
+	if lm.options.SharedRetention != nil {
+		lm.options.SharedRetention.leave(lm)
+	}
+
+	// Finish off the last line, but don't let that stop us closing the file
+	if lm.options.EnsureTrailingNewline && lm.currentFile != nil {
+		err = lm.wake()
+		if err == nil {
+			err = lm.ensureTrailingNewline()
+		}
+		if err != nil {
+			lm.logf("%s", err)
+		}
+	}
+
+	if lm.currentFile != nil && !lm.idle {
+		err = lm.closeFile(lm.currentFile)
+		if err != nil {
+			return fmt.Errorf("unable to close log file: %w", err)
+		}
+	}
+
+	if lm.latestFile != nil {
+		lm.latestFile.Close()
+		lm.latestFile = nil
+	}
+
+	err = lm.closeSink()
+	if err != nil {
+		return
+	}
+
+	if lm.options.BundleOnClose {
+		err = lm.bundle()
+		if err != nil {
+			return fmt.Errorf("unable to bundle old logs: %w", err)
+		}
+	}
+
+	if lm.options.SequenceNumbers {
+		err = lm.saveSequence()
+		if err != nil {
+			return
+		}
+	}
+
+	if lm.options.WritePIDFile {
+		err = lm.removePIDFile()
+	}
+
+	return
+}
+
+// bundleFormat is a helper function that returns the format bundles are written in. A plain .gz only holds one file.
+func (lm *LogManager) bundleFormat() CompressionFormat {
+	if lm.options.CompressionFormat == CompressGzip {
+		return CompressTarGz
+	}
+	return lm.options.CompressionFormat
+}
+
+// openFiles is a helper function that counts the handles the log manager is holding open, for leak checks: the current
+// log (and its gzip stream, if it has one), and latest. The PID and sequence files are never left open.
+func (lm *LogManager) openFiles() (n int) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if lm.currentFile != nil && !lm.idle {
+		n++
+	}
+	if lm.stream != nil {
+		n++
+	}
+	if lm.latestFile != nil {
+		n++
+	}
+	return
+}
+
+// background is a helper function that counts the background compressions and timers still running, for leak checks
+func (lm *LogManager) background() (n int) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if lm.idleTimer != nil {
+		n++
+	}
+	return n + int(atomic.LoadInt64(&lm.compressing))
+}
+
+// bundle is a helper function that tars all of the uncompressed rotated logs in the log directory into a
+// single bundle-<timestamp>.tar.gz (or .zip), then removes the originals. The current log file is left alone.
+func (lm *LogManager) bundle() (err error) {
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		return
+	}
+
+	var pending []string
+	for _, entry := range entries {
+		fn := filepath.Join(lm.options.Dir, entry.Name())
+		if entry.IsDir() || lm.ignored(entry.Name()) || isArchive(entry.Name()) || lm.currentFile != nil && fn == lm.currentFile.Name() {
+			continue
+		}
+		pending = append(pending, fn)
+	}
+
+	// Nothing to bundle
+	if len(pending) == 0 {
+		return
+	}
+
+	format := lm.bundleFormat()
+	err = lm.archive(context.Background(), filepath.Join(lm.options.Dir, "bundle-"+lm.options.Now().Format("2006-01-02T15-04-05")+format.ext()), format, pending...)
+	if err != nil {
+		return
+	}
+
+	for _, fn := range pending {
+		err = os.Remove(fn)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// isReserved is a helper function that reports whether name is one of the files the log manager keeps
+// in the log directory for itself, rather than a log. Temp files are checked for separately (see isTemp).
+func isReserved(name string) bool {
+	return name == "latest" || name == "latest.log" || name == pidFileName || name == sequenceFileName || strings.HasSuffix(name, metaSuffix) || strings.HasPrefix(name, manifestName)
+}
+
+// ignored is a helper function that checks if a file called name is one of ours, but not a log: reserved, or a
+// temporary file that's still being written (or was left behind by a crash)
+func (lm *LogManager) ignored(name string) bool {
+	return isReserved(name) || isTemp(name, lm.options.TempSuffix)
+}
+
+// isTemp is a helper function that checks if a file called name is a temporary file, as named by tempPattern
+func isTemp(name, suffix string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, suffix)
+}
+
+// tempPattern is a helper function that returns the os.CreateTemp pattern for a temporary file that's going to
+// replace the one at path. It's hidden, and ends with TempSuffix, so watchers can tell to leave it alone.
+func (lm *LogManager) tempPattern(path string) string {
+	return "." + filepath.Base(path) + ".*" + lm.options.TempSuffix
+}
+
+// setSymlink is a helper function to update/create the "latest" symlink in the log directory
+func (lm *LogManager) setSymlink() (err error) {
+	latestDotLog := filepath.Join(lm.options.Dir, "latest")
+
+	// Stop mirroring writes to the old copy
+	if lm.latestFile != nil {
+		lm.latestFile.Close()
+		lm.latestFile = nil
+	}
+
+	// Leave anything called latest alone if we aren't the ones who put it there
+	if !lm.options.LatestDotLog && lm.options.ManageLatestOnly && !lm.ownsLatest {
+		return nil
+	}
+
+	// Make sure we don't clobber a real file that just happens to be called latest
+	// Only the symlink strategy is expected to leave anything but a symlink there
+	if info, err := os.Lstat(latestDotLog); err == nil && info.Mode()&os.ModeSymlink == 0 && !lm.options.ForceLatest {
+		switch {
+		case !lm.options.LatestDotLog:
+			return nil
+		case lm.options.LatestStrategy == LatestSymlink:
+			return fmt.Errorf("unable to replace %s, it's not a symlink", latestDotLog)
+		}
+	}
+
+	os.Remove(latestDotLog)
+	lm.ownsLatest = false
+	if lm.options.LatestDotLog && lm.currentFile != nil {
+		// Point latest to the current log file, however we've been told to
+		switch lm.options.LatestStrategy {
+		case LatestHardlink:
+			err = os.Link(lm.currentFile.Name(), latestDotLog)
+		case LatestCopy:
+			err = lm.copyLatest(latestDotLog)
+		case LatestPointer:
+			err = lm.writePointer(latestDotLog)
+		default:
+			target := lm.currentFile.Name()
+			if lm.options.SymlinkTargetFunc != nil {
+				lm.hook(func() { target = lm.options.SymlinkTargetFunc(target) })
+			}
+			err = os.Symlink(target, latestDotLog)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to create latest: %w", err)
+		}
+		lm.ownsLatest = true
+	}
+
+	return
+}
+
+// expandEnvOutsideActions is a helper function that expands environment variables in the static parts of a template,
+// leaving anything between {{ and }} alone, since template variables look like environment variables
+func expandEnvOutsideActions(format string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(format, "{{")
+		if start < 0 {
+			b.WriteString(os.ExpandEnv(format))
+			return b.String()
+		}
+		end := strings.Index(format[start:], "}}")
+		if end < 0 {
+			b.WriteString(os.ExpandEnv(format[:start]))
+			b.WriteString(format[start:])
+			return b.String()
+		}
+		end += start + len("}}")
+
+		b.WriteString(os.ExpandEnv(format[:start]))
+		b.WriteString(format[start:end])
+		format = format[end:]
+	}
+}
+
+// withDefaults is a helper function that returns a copy of options with the defaults filled in
+func (options LogManagerOptions) withDefaults() LogManagerOptions {
+	if options.ExpandEnv {
+		options.Dir = os.ExpandEnv(options.Dir)
+		options.ArchiveDir = os.ExpandEnv(options.ArchiveDir)
+		options.FilenameFormat = expandEnvOutsideActions(options.FilenameFormat)
+	}
+
+	options.Dir = filepath.Clean(options.Dir)
+	if options.ArchiveDir != "" {
+		options.ArchiveDir = filepath.Clean(options.ArchiveDir)
+	}
+
+	// Check if filename format is set, otherwise use default
+	if options.FilenameFormat == "" {
+		options.FilenameFormat = `{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log`
+	}
+
+	if options.MaxIteration == 0 {
+		options.MaxIteration = DefaultMaxIteration
+	}
+	if options.CopyBufferSize <= 0 {
+		options.CopyBufferSize = DefaultCopyBufferSize
+	}
+
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	if options.TempSuffix == "" {
+		options.TempSuffix = DefaultTempSuffix
+	}
+	if options.RateWindow <= 0 {
+		options.RateWindow = DefaultRateWindow
+	}
+
+	return options
+}
+
+// parseMarker parses the RotationMarker template, returning nil if there isn't one
+func parseMarker(marker string) (*template.Template, error) {
+	if marker == "" {
+		return nil, nil
+	}
+	return template.New("").Parse(marker)
+}
+
+// Create a new LogManager, and Open it. `timeFormat` is the format used in `filenameFormat`. `filenameFormat` is a template string for type LogNameTemplate.
+// It panics if the log directory can't be set up.
+func NewLogManager(options LogManagerOptions) *LogManager {
+	lm := New(options)
+	err := lm.Open()
+	if err != nil {
+		panic(err)
+	}
+
+	return lm
+}
+
+// New creates a LogManager without touching the filesystem. It must be opened with Open before it's written to.
+func New(options LogManagerOptions) *LogManager {
+	lm := LogManager{mutex: newMutex(), fs: osFS{}, closing: make(chan struct{})}
+	lm.compressor = lm.compress
+
+	// Keep the options with the defaults applied
+	options = options.withDefaults()
+	lm.options = options
+	lm.writeTimeout = int64(options.WriteTimeout)
+	lm.onDrop.Store(options.OnDrop)
+	lm.setTees(options.Tee)
+	lm.now.Store(options.Now)
+	lm.stats.rateWindow = int64(options.RateWindow)
+
+	return &lm
+}
+
+// Open sets up the log directory, and opens the log file to write to, picking up where the newest existing log left off.
+// Calling it again once it's succeeded returns an error.
+func (lm *LogManager) Open() (err error) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if lm.opened {
+		return errors.New("log manager is already open")
+	}
+
+	options := lm.options
+	lm.started = options.Now()
+
+	// Validate template string
+	lm.templater, err = template.New("").Parse(options.FilenameFormat)
+	if err != nil {
+		return fmt.Errorf("unable to parse filename format: %w", err)
+	}
+	lm.marker, err = parseMarker(options.RotationMarker)
+	if err != nil {
+		return fmt.Errorf("unable to parse rotation marker: %w", err)
+	}
+
+	// Check if the directory exists and create it if it doesn't
+	_, err = os.Stat(options.Dir)
+	if os.IsNotExist(err) {
+		err = os.Mkdir(options.Dir, 0755)
+		if err != nil {
+			return fmt.Errorf("unable to create log directory: %w", err)
+		}
+	}
+
+	// Claim the directory before touching anything in it
+	if options.WritePIDFile {
+		err = lm.writePIDFile()
+		if err != nil {
+			return
+		}
+
+		// Let go of it again if we can't finish opening, so it doesn't look like the directory's still in use
+		defer func() {
+			if err != nil {
+				lm.removePIDFile()
+			}
+		}()
+	}
+
+	// Carry on numbering writes from where the last run left off
+	if options.SequenceNumbers {
+		err = lm.loadSequence()
+		if err != nil {
+			return
+		}
+	}
+
+	// If latest.log exists, but options.LatestDotLog is false, remove it
+	// Unless we've been told to only touch what we manage, since those could be someone else's files in a shared directory
+	if !options.ManageLatestOnly {
+		latestDotLog := filepath.Join(options.Dir, "latest.log")
+		os.Remove(latestDotLog)
+		if !options.LatestDotLog {
+			latestDotLog = filepath.Join(options.Dir, "latest")
+			os.Remove(latestDotLog)
+		}
+	}
+
+	// Read all files in the directory, find the latest one
+	// A FIFO is always reopened by name, so there's nothing to look for
+	// If we've been given a file to carry on with, there's nothing to look for either
+	var newestFile *os.FileInfo
+	var newestPath string
+	if options.AdoptFile != "" {
+		newestPath = options.AdoptFile
+		if !filepath.IsAbs(newestPath) {
+			newestPath = filepath.Join(options.Dir, newestPath)
+		}
+		info, err := os.Stat(newestPath)
+		if err != nil {
+			return fmt.Errorf("unable to adopt log file: %w", err)
+		}
+		newestFile = &info
+		lm.adopted = newestPath
+	}
+	names := lm.logNames()
+	err = filepath.Walk(options.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// A log that was compressed as it was written can't be carried on with either, so a stream starts afresh
+		if options.FIFO || options.AdoptFile != "" || lm.streaming() {
+			return filepath.SkipDir
+		}
+
+		// Archives might be kept in a subdirectory, which is never where the current log is, and so might partitions
+		if info.IsDir() && (options.ArchiveDir != "" && path == options.ArchiveDir || lm.isPartition(path)) {
+			return filepath.SkipDir
+		}
+
+		if !info.Mode().IsRegular() || lm.ignored(info.Name()) || isArchive(info.Name()) {
+			return nil
+		}
+		// Another manager's log might be sharing the directory
+		if names != nil && !names.MatchString(filepath.ToSlash(path)) {
+			return nil
+		}
+
+		if newestFile == nil || info.ModTime().After((*newestFile).ModTime()) {
+			newestFile = &info
+			newestPath = filepath.Join(options.Dir, info.Name())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to find the newest log: %w", err)
+	}
+
+	if newestFile == nil && options.LazyCreate && !options.FIFO {
+		// Leave creating it to the first write, so a run that never logs anything doesn't leave an empty file behind
+		lm.pending = true
+	} else if newestFile == nil {
+		// If there is no newest file, create one
+		// A FIFO might not have a reader yet, the first write will try again
+		err = lm.rotate()
+		if err != nil && !options.FIFO {
+			return fmt.Errorf("unable to create log file: %w", err)
+		}
+	} else {
+		// Otherwise, open it
+		lm.currentFile, err = os.OpenFile(newestPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to open log file: %w", err)
+		}
+		lm.stats.currentFileSize = (*newestFile).Size()
+		lm.currentBase = lm.baseName((*newestFile).ModTime())
+	}
+
+	// The last run might have got further than it saved, if it didn't get to close
+	if options.SequenceNumbers && newestFile != nil {
+		err = lm.recoverSequence(newestPath)
+		if err != nil {
+			return
+		}
+	}
+
+	// Set symlink
+	err = lm.setSymlink()
+	if err != nil {
+		return
+	}
+
+	// Let the other managers sharing our retention know which log is ours
+	if options.SharedRetention != nil {
+		options.SharedRetention.update(lm)
+	}
+
+	// Clean up after a crash during compression
+	// Archives that have been through a pipe can't be read back, so they can't be checked
+	if options.RepairArchivesOnStart && options.GZIP && options.ArchivePipe == nil {
+		lm.repairArchives()
+	}
+
+	if options.RotationInterval != 0 || options.RotationSchedule != RotateNone {
+		if newestFile != nil {
+			// Since we have a rotation interval, we can accurately estimate the time of the last rotation
+			// The file was created by the last rotation, so use the time it was started at if we can tell, which holds up
+			// even if the interval has changed since it was written
+			// Otherwise, we'll look at the modtime of the current file and truncate it to the nearest rotation interval (floor, basically)
+			// A schedule's boundaries don't depend on exactly when the last rotation was, so the modtime will do as-is
+			if started, ok := lm.startTime(newestPath, *newestFile); ok {
+				lm.lastRotation = started
+			} else if options.RotationInterval != 0 {
+				lm.lastRotation = (*newestFile).ModTime().Truncate(options.RotationInterval)
+			} else {
+				lm.lastRotation = (*newestFile).ModTime()
+			}
+		}
+	}
+
+	// Give this run a file of its own, rotating away from the one we'd have carried on with
+	// With LazyCreate, that waits until the first write
+	if options.FreshOnStart && newestFile != nil && options.LazyCreate {
+		lm.pending = true
+	} else if options.FreshOnStart && newestFile != nil {
+		err = lm.rotate()
+		if err != nil {
+			return fmt.Errorf("unable to create log file: %w", err)
+		}
+	}
+
+	// Start writing in the background, now that there's somewhere to write to
+	if options.AsyncQueue > 0 {
+		lm.startQueue(options.AsyncQueue, options.QueueFullPolicy)
+	}
+	if options.Syslog != nil {
+		lm.syslog = startSyslog(*options.Syslog, options.Logger)
+	}
+
+	lm.opened = true
+	return nil
+}
+
+// startTime is a helper function that works out when the log at path was started: its creation time if the platform
+// keeps track of it, otherwise the timestamp on its first line, if it has one
+func (lm *LogManager) startTime(path string, info os.FileInfo) (time.Time, bool) {
+	if born, ok := lm.fs.BirthTime(info); ok {
+		return born, true
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	line, _ := bufio.NewReader(f).ReadBytes('\n')
+	return parseLineTime(line)
+}
+
+// shift is a helper function that renames the numbered backups of filename (and of it in archiveDir, if set) up by
+// one, then renames filename itself to .1, like logrotate does. It returns the new name of filename.
+func shift(filename, archiveDir string) (backup string, err error) {
+	dir, base := filepath.Dir(filename), filepath.Base(filename)
+
+	err = shiftBackups(dir, base, 1)
+	if err != nil {
+		return
+	}
+	if archiveDir != "" && archiveDir != dir {
+		err = shiftBackups(archiveDir, base, 1)
+		if err != nil {
+			return
+		}
+	}
+
+	backup = filename + ".1"
+	err = replaceFile(filename, backup)
+	if err != nil {
+		return "", err
+	}
+
+	return
+}
+
+// unshift is a helper function that undoes shift, moving backup back to filename, then the numbered backups back down
+// by one (.2 → .1, etc.)
+func unshift(filename, backup, archiveDir string) (err error) {
+	dir, base := filepath.Dir(filename), filepath.Base(filename)
+
+	err = replaceFile(backup, filename)
+	if err != nil {
+		return
+	}
+	err = shiftBackups(dir, base, -1)
+	if err != nil {
+		return
+	}
+	if archiveDir != "" && archiveDir != dir {
+		err = shiftBackups(archiveDir, base, -1)
+	}
+	return
+}
+
+// shiftBackups is a helper function that renames the numbered backups of base in dir up (or down) by `by`
+func shiftBackups(dir, base string, by int) (err error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return
+	}
+
+	// Find all of the numbered backups, compressed or not
+	type numbered struct {
+		n      uint64
+		suffix string
+	}
+	var backups []numbered
+	for _, entry := range entries {
+		rest := strings.TrimPrefix(entry.Name(), base+".")
+		if rest == entry.Name() {
+			continue
+		}
+
+		suffix := archiveExt(rest)
+		rest = strings.TrimSuffix(rest, suffix)
+
+		n, err := strconv.ParseUint(rest, 10, 64)
+		if err != nil || n == 0 || int64(n)+int64(by) < 1 {
+			continue
+		}
+		backups = append(backups, numbered{n, suffix})
+	}
+
+	// Shift the highest numbers first (or the lowest, going down), so we never overwrite anything
+	sort.Slice(backups, func(i, j int) bool {
+		if by < 0 {
+			return backups[i].n < backups[j].n
+		}
+		return backups[i].n > backups[j].n
+	})
+	for _, b := range backups {
+		from := filepath.Join(dir, fmt.Sprintf("%s.%d%s", base, b.n, b.suffix))
+		to := filepath.Join(dir, fmt.Sprintf("%s.%d%s", base, int64(b.n)+int64(by), b.suffix))
+		err = os.Rename(from, to)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// ArchivePathFor returns where the log at logPath (relative to Dir, or absolute) is compressed to, whether or not it has
+// been yet. In ShiftMode, that's the archive of its shifted name (e.g. app.log.1).
+func (lm *LogManager) ArchivePathFor(logPath string) string {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if !filepath.IsAbs(logPath) {
+		logPath = filepath.Join(lm.options.Dir, logPath)
+	}
+	return lm.archivePath(logPath)
+}
+
+// archivePath is a helper function that returns where the log file at filename gets compressed to,
+// taking ShiftMode, AppendArchiveExt, and ArchiveDir into account
+func (lm *LogManager) archivePath(filename string) string {
+	fn := archiveName(filename, lm.options.CompressionFormat)
+	if lm.options.ShiftMode || lm.options.AppendArchiveExt {
+		fn = filename + lm.options.CompressionFormat.ext()
+	}
+
+	return lm.inArchiveDir(fn)
+}
+
+// inArchiveDir is a helper function that moves fn from Dir to ArchiveDir (if it's set), keeping the same relative layout
+func (lm *LogManager) inArchiveDir(fn string) string {
+	if lm.options.ArchiveDir != "" {
+		if rel, err := filepath.Rel(lm.options.Dir, fn); err == nil {
+			fn = filepath.Join(lm.options.ArchiveDir, rel)
+		}
+	}
+	return fn
+}
+
+// variants is a helper function that returns every name a log called filename could be found under:
+// itself, its archives in any format (with either naming convention), and their metadata files
+func (lm *LogManager) variants(filename string) []string {
+	names := []string{filename}
+	for _, format := range []CompressionFormat{CompressTarGz, CompressZip, CompressGzip} {
+		for _, archive := range []string{archiveName(filename, format), filename + format.ext()} {
+			archive = lm.inArchiveDir(archive)
+			names = append(names, archive, archive+metaSuffix)
+		}
+	}
+	return names
+}
+
+// inUse is a helper function that checks if filename already exists in any form (see variants)
+func (lm *LogManager) inUse(filename string) (bool, error) {
+	for _, name := range lm.variants(filename) {
+		_, err := os.Stat(name)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("unable to stat file: %w", err)
+		}
+	}
+	return false, nil
+}
+
+// checkFilename is a helper function that makes sure a rendered filename stays inside of the log directory
+func checkFilename(name string) error {
+	clean := filepath.Clean(name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("filename %q is not inside of the log directory", name)
+	}
+
+	return nil
+}
+
+// archiveName is a helper function that returns the name of the archive a log file gets compressed into
+func archiveName(filename string, format CompressionFormat) string {
+	return filepath.Join(filepath.Dir(filename), strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))) + format.ext()
+}
+
+// compress is a helper function to compress a file into the archive at dest
+func (lm *LogManager) compress(ctx context.Context, filename, dest string) (err error) {
+	// Prevent compressing a file that's already compressed
+	if isArchive(filename) {
+		return
+	}
+
+	return lm.archive(ctx, dest, lm.options.CompressionFormat, filename)
+}
+
+// archive is a helper function to compress one or more files into the archive at dest, in the given format.
+// If ctx is done before it's finished, it stops, and nothing is left behind.
+func (lm *LogManager) archive(ctx context.Context, dest string, format CompressionFormat, filenames ...string) (err error) {
+	// Referenced from https://www.arthurkoziel.com/writing-tar-gz-files-in-go/
+
+	// Create writer for a temp file next to our destination archive, so nobody ever sees a partially written archive
+	buf, err := os.CreateTemp(filepath.Dir(dest), lm.tempPattern(dest))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			buf.Close()
+			os.Remove(buf.Name())
+		}
+	}()
+
+	// Pass the archive through the pipe on its way to disk, if there is one (e.g. to encrypt it)
+	var w io.Writer = buf
+	var pipe io.WriteCloser
+	if lm.options.ArchivePipe != nil {
+		lm.hook(func() { pipe = lm.options.ArchivePipe(buf) })
+		w = pipe
+
+		// Whatever's behind the pipe (e.g. a process) still has to be let go of if the archive can't be finished
+		defer func() {
+			if pipe != nil {
+				lm.hook(func() { pipe.Close() })
+			}
+		}()
+	}
+	w = contextWriter{ctx, w}
+
+	// Flush everything before moving the archive into place. The pipe and TarEntryNameFunc are the user's, so they
+	// mustn't write to us.
+	copyBuf := getCopyBuffer(lm.options.CopyBufferSize)
+	defer copyBuffers.Put(copyBuf)
+	lm.hook(func() {
+		switch {
+		case format == CompressZip:
+			err = writeZip(w, *copyBuf, filenames...)
+		case format == CompressGzip && len(filenames) == 1:
+			err = writeGzip(w, *copyBuf, filenames[0], lm.options.GZIPComment)
+		default:
+			entryName := lm.options.TarEntryNameFunc
+			if entryName == nil {
+				entryName = filepath.Base
+			}
+			err = writeTarGz(w, *copyBuf, lm.options.GZIPComment, entryName, filenames...)
+		}
+	})
+	if err != nil {
+		return
+	}
+	if pipe != nil {
+		lm.hook(func() { err = pipe.Close() })
+		pipe = nil
+		if err != nil {
+			return fmt.Errorf("unable to close archive pipe: %w", err)
+		}
+	}
+
+	// Make sure the archive is on disk before it replaces anything
+	if lm.options.SyncDir {
+		err = lm.fs.Sync(buf)
+		if err != nil {
+			return
+		}
+	}
+
+	err = buf.Close()
+	if err != nil {
+		return
+	}
+
+	err = replaceFile(buf.Name(), dest)
+	if err != nil {
+		return
+	}
+
+	// Make sure the rename itself is on disk too
+	if lm.options.SyncDir {
+		err = lm.fs.SyncDir(filepath.Dir(dest))
+	}
+
+	return
+}
+
+// writeTarGz is a helper function to tar and gzip one or more files, naming each entry with entryName
+func writeTarGz(w io.Writer, buf []byte, comment string, entryName func(string) string, filenames ...string) (err error) {
+	gw := gzip.NewWriter(w)
+	gw.Comment = comment
+	tw := tar.NewWriter(gw)
+
+	for _, filename := range filenames {
+		err = addToArchive(tw, filename, entryName(filename), buf)
+		if err != nil {
+			return
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return
+	}
+	return gw.Close()
+}
 
+// addToArchive is a helper function to write a single file into a tar archive, as name
+func addToArchive(tw *tar.Writer, filename, name string, buf []byte) (err error) {
 	// Open the file which will be written into the archive
 	file, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
 	// Get FileInfo about our file providing file size, mode, etc.
 	info, err := file.Stat()
@@ -289,8 +2439,7 @@ func compress(filename string) (err error) {
 		return err
 	}
 
-	// Use full path as name (FileInfoHeader only takes the basename)
-	header.Name = filename
+	header.Name = name
 
 	// Write file header to the tar archive
 	err = tw.WriteHeader(header)
@@ -299,7 +2448,7 @@ func compress(filename string) (err error) {
 	}
 
 	// Copy file content to tar archive
-	_, err = io.Copy(tw, file)
+	err = copyFile(tw, file, buf)
 	if err != nil {
 		return err
 	}
@@ -1,11 +1,22 @@
 package logmanager
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -28,6 +39,74 @@ func setup(options LogManagerOptions) *LogManager {
 	return lm
 }
 
+func TestNotOpen(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm := New(LogManagerOptions{Dir: dir})
+
+	// There's nothing to write to yet, which shouldn't be mistaken for a file that's gone missing
+	for name, call := range map[string]func() error{
+		"Write":     func() error { _, err := lm.Write([]byte("test")); return err },
+		"WriteAll":  func() error { _, err := lm.WriteAll([][]byte{[]byte("test")}); return err },
+		"AppendRaw": func() error { _, err := lm.AppendRaw([]byte("test")); return err },
+		"WriteAt":   func() error { _, err := lm.WriteAt(time.Now(), []byte("test")); return err },
+		"Rotate":    lm.Rotate,
+	} {
+		if err := call(); !errors.Is(err, ErrNotOpen) {
+			t.Errorf("%s before Open returned %v, expected ErrNotOpen", name, err)
+		}
+	}
+
+	err = lm.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lm.Open() == nil {
+		t.Error("Opening twice was allowed")
+	}
+
+	lm.Close()
+	os.RemoveAll(dir)
+}
+
+func TestOpen(t *testing.T) {
+	parent, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+
+	// Building shouldn't touch the filesystem
+	dir := filepath.Join(parent, "logs")
+	lm := New(LogManagerOptions{Dir: dir})
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("New created the log directory")
+	}
+
+	err = lm.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lm.CurrentFilename() == "" || filepath.Dir(lm.CurrentFilename()) != dir {
+		t.Errorf("Open didn't create a log file in %s", dir)
+	}
+	lm.Close()
+
+	// Problems should come back from Open, rather than panicking
+	err = New(LogManagerOptions{Dir: dir, FilenameFormat: "{{ .Nope"}).Open()
+	if err == nil {
+		t.Error("Open didn't fail with a broken filename format")
+	}
+	blocker := filepath.Join(parent, "blocker")
+	os.WriteFile(blocker, nil, 0644)
+	err = New(LogManagerOptions{Dir: filepath.Join(blocker, "logs")}).Open()
+	if err == nil {
+		t.Error("Open didn't fail when the log directory couldn't be created")
+	}
+}
+
 func TestNextRotation(t *testing.T) {
 	// This shouldn't work, because we haven't included a variation for interval, so the file should not rotate
 	lm := setup(LogManagerOptions{
@@ -364,6 +443,73 @@ func TestFileDeleted(t *testing.T) {
 	os.RemoveAll(lm.options.Dir)
 }
 
+func TestFileRenamed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Open files can't be renamed on Windows")
+	}
+	lm := setup(LogManagerOptions{MaxFileSize: 100})
+	lm.Write([]byte("1234"))
+
+	// Rename the log, and put something else in its place
+	original := lm.currentFile.Name()
+	moved := original + ".moved"
+	err := os.Rename(original, moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(original, []byte("replaced\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The manager should notice its name leads somewhere else now, and carry on there
+	lm.Write([]byte("5678"))
+	for name, want := range map[string]string{moved: "1234", original: "replaced\n5678"} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", name, b, want)
+		}
+	}
+	if lm.currentFile.Name() != original {
+		t.Errorf("Rotated to %s", lm.currentFile.Name())
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestFileDeletedWhileOpen(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Open files can't be deleted on Windows")
+	}
+	lm := setup(LogManagerOptions{})
+	lm.Write([]byte("1234"))
+
+	// Delete the log out from under the open file
+	name := lm.currentFile.Name()
+	err := os.Remove(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next write should recreate it, rather than disappearing into the deleted file
+	lm.Write([]byte("5678"))
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "5678" {
+		t.Errorf("Recreated log contains %q, expected %q", b, "5678")
+	}
+	if lm.Stats().CurrentFileSize != 4 {
+		t.Errorf("Current file size is %d, expected 4", lm.Stats().CurrentFileSize)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
 func TestRepeatedCompressionCalls(t *testing.T) {
 	lm := setup(LogManagerOptions{
 		GZIP: true,
@@ -376,16 +522,1897 @@ func TestRepeatedCompressionCalls(t *testing.T) {
 	}
 
 	// Rotate again
+	old := lm.currentFile.Name()
 	err = lm.Rotate()
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// Check if file is gzipped
-	_, err = os.Stat(strings.TrimSuffix(lm.currentFile.Name(), ".log") + ".tar.gz")
+	_, err = os.Stat(strings.TrimSuffix(old, ".log") + ".tar.gz")
+	if err != nil {
+		t.Error(err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestPreviousTemplate(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: `{{ if .Previous }}next-{{ .Previous }}{{ else }}first.log{{ end }}`,
+	})
+
+	if filepath.Base(lm.currentFile.Name()) != "first.log" {
+		t.Fatal("First filename is not correct")
+	}
+
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the template received the old filename
+	if filepath.Base(lm.currentFile.Name()) != "next-first.log" {
+		t.Error("Template did not receive the previous filename")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestShiftMode(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "app.log",
+		ShiftMode:      true,
+	})
+
+	// Write, then rotate twice
+	for _, s := range []string{"first", "second"} {
+		lm.Write([]byte(s))
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	lm.Write([]byte("third"))
+
+	// Active file should keep its name
+	if filepath.Base(lm.currentFile.Name()) != "app.log" {
+		t.Error("Active file was renamed")
+	}
+
+	// Check that each file holds the expected content
+	for name, want := range map[string]string{"app.log": "third", "app.log.1": "second", "app.log.2": "first"} {
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", name, b, want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestShiftModeOpenFailure(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "app.log",
+		ShiftMode:      true,
+	})
+	lm.Write([]byte("first"))
+	lm.Rotate()
+	lm.Write([]byte("second"))
+
+	// If the new file can't be opened, the shift should be undone
+	fs := &mockFS{failOpens: 1 << 30, openErr: os.ErrPermission}
+	lm.fs = fs
+	if err := lm.Rotate(); err == nil {
+		t.Fatal("Rotating succeeded, even though the new file couldn't be opened")
+	}
+	if _, err := lm.Write([]byte("lost")); err == nil {
+		t.Error("Writing succeeded, even though the file couldn't be opened")
+	}
+
+	// Once it can be opened again, writes carry on in the old file
+	fs.failOpens = 0
+	if _, err := lm.Write([]byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"app.log": "secondthird", "app.log.1": "first"} {
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", name, b, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(lm.options.Dir, "app.log.2")); !os.IsNotExist(err) {
+		t.Error("Backups were left shifted")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestShiftModeGZIP(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "app.log",
+		ShiftMode:      true,
+		GZIP:           true,
+	})
+
+	for i := 0; i < 2; i++ {
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Check that the compressed backups were shifted too
+	for _, name := range []string{"app.log.1.tar.gz", "app.log.2.tar.gz"} {
+		if _, err := os.Stat(filepath.Join(lm.options.Dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(lm.options.Dir, "app.log.1")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Uncompressed backup was not deleted")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestBundleOnClose(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		BundleOnClose: true,
+	})
+
+	// Create several rotated files
+	for i := 0; i < 3; i++ {
+		lm.Write([]byte("test"))
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	active := lm.currentFile.Name()
+
+	err := lm.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that there's exactly one bundle, plus the active file
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundles []string
+	for _, entry := range entries {
+		switch {
+		case strings.HasPrefix(entry.Name(), "bundle-") && strings.HasSuffix(entry.Name(), ".tar.gz"):
+			bundles = append(bundles, filepath.Join(lm.options.Dir, entry.Name()))
+		case entry.Name() != filepath.Base(active):
+			t.Errorf("Unexpected file %s was not bundled", entry.Name())
+		}
+	}
+	if len(bundles) != 1 {
+		t.Fatalf("Expected 1 bundle, found %d", len(bundles))
+	}
+
+	// Check that the bundle contains all 3 rotated files
+	f, err := os.Open(bundles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	count := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if header.Name == filepath.Base(active) {
+			t.Error("Active file was bundled")
+		}
+		count++
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 files in bundle, found %d", count)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestCloseReleasesResources(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		LatestDotLog:   true,
+		LatestStrategy: LatestCopy,
+		GZIP:           true,
+		AsyncCompress:  true,
+		CloseWhenIdle:  time.Hour,
+	})
+
+	lm.Write([]byte("test"))
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm.Write([]byte("test"))
+	if n := lm.openFiles(); n != 2 {
+		t.Errorf("Expected the current log and latest to be open, %d files are", n)
+	}
+
+	err = lm.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := lm.openFiles(); n != 0 {
+		t.Errorf("%d files are still open after closing", n)
+	}
+	if n := lm.background(); n != 0 {
+		t.Errorf("%d compressions or timers are still running after closing", n)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		WriteTimeout: time.Millisecond * 50,
+	})
+
+	// Hold the lock, like a long rotation would
+	lm.Lock()
+
+	start := time.Now()
+	_, err := lm.Write([]byte("test"))
+	if !errors.Is(err, ErrWriteTimeout) {
+		t.Errorf("Expected ErrWriteTimeout, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Write blocked for longer than the timeout")
+	}
+
+	lm.Unlock()
+
+	// Once the lock is released, writes should go through again
+	_, err = lm.Write([]byte("test"))
 	if err != nil {
 		t.Error(err)
 	}
 
 	os.RemoveAll(lm.options.Dir)
 }
+
+func TestDryRun(t *testing.T) {
+	out := new(bytes.Buffer)
+	lm := setup(LogManagerOptions{
+		DryRun: true,
+		GZIP:   true,
+		Logger: log.New(out, "", 0),
+	})
+
+	lm.Write([]byte("test1"))
+	before, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := lm.currentFile.Name()
+
+	err = lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm.Write([]byte("test2"))
+
+	// Check that nothing changed on disk
+	after, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before) != len(after) {
+		t.Error("Dry run changed the log directory")
+	}
+	if lm.currentFile.Name() != old {
+		t.Error("Dry run rotated the log file")
+	}
+	b, err := os.ReadFile(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "test1test2" {
+		t.Error("Dry run did not keep appending to the current file")
+	}
+
+	// Check that the decisions were reported
+	if !strings.Contains(out.String(), "would compress "+old) || !strings.Contains(out.String(), "would rotate to") {
+		t.Errorf("Dry run decisions were not reported: %q", out.String())
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestOptions(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+
+	// Check that the defaults were applied
+	options := lm.Options()
+	if options.FilenameFormat != `{{ .Time.Format "2006-01-02" }}_{{ .Iteration }}.log` {
+		t.Errorf("Default filename format was not applied: %q", options.FilenameFormat)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+
+	// Check that Dir gets cleaned
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm = NewLogManager(LogManagerOptions{Dir: dir + "/./"})
+	if lm.Options().Dir != filepath.Clean(dir) {
+		t.Errorf("Dir was not cleaned: %q", lm.Options().Dir)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestMinFileSize(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		MaxFileSize: 10,
+		MinFileSize: 1,
+	})
+
+	// Every write is bigger than the max file size, but none of them should leave an empty file behind
+	for i := 0; i < 5; i++ {
+		_, err := lm.Write([]byte("123456789012"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Errorf("Expected 5 files, found %d", len(entries))
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			t.Errorf("%s is empty", entry.Name())
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestResumeMidPeriod(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		RotationInterval: time.Hour,
+	})
+	lm.Write([]byte("test"))
+	name := lm.CurrentFilename()
+	lm.Close()
+
+	// Pretend the file was last written to a few hours ago, even though it was just created
+	past := time.Now().Add(-time.Hour * 3)
+	err := os.Chtimes(name, past, past)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart; the file was created moments ago, so it shouldn't rotate
+	// Not every platform keeps track of when files were created, so say when it was
+	lm = New(LogManagerOptions{
+		Dir:              lm.options.Dir,
+		RotationInterval: time.Hour,
+	})
+	lm.fs = &mockFS{born: time.Now(), reportBorn: true}
+	err = lm.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm.Write([]byte("test"))
+	if lm.currentFile.Name() != name {
+		t.Error("Log file rotated immediately after restarting mid-period")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestResumeIntervalChanged(t *testing.T) {
+	started := time.Date(2022, 5, 17, 8, 0, 0, 0, time.Local)
+	modified := time.Date(2022, 5, 17, 10, 50, 0, 0, time.Local)
+
+	for _, test := range []struct {
+		interval time.Duration
+		restart  time.Time
+		rotateAt time.Time // Rotating any earlier is wrong
+	}{
+		// Grown, so the log carries on until it's been open that long
+		{24 * time.Hour, time.Date(2022, 5, 18, 7, 0, 0, 0, time.Local), started.Add(24 * time.Hour)},
+		// Shrunk to less than the log's age, so it's rotated on the first write
+		{time.Hour, modified.Add(5 * time.Minute), modified.Add(5 * time.Minute)},
+	} {
+		dir, err := os.MkdirTemp("", "logmanager_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(dir, "app_0.log")
+		err = os.WriteFile(filename, []byte(started.Format("2006/01/02 15:04:05")+" started\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(filename, modified, modified)
+
+		// Restart with the new interval, as if the platform didn't keep track of creation times, so the first line is used
+		now := test.restart
+		lm := New(LogManagerOptions{
+			Dir:              dir,
+			FilenameFormat:   "app_{{ .Iteration }}.log",
+			RotationInterval: test.interval,
+			Now:              func() time.Time { return now },
+		})
+		lm.fs = &mockFS{reportBorn: true}
+		err = lm.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lm.CurrentFilename() != filename {
+			t.Fatalf("Resumed with %s instead of %s", lm.CurrentFilename(), filename)
+		}
+
+		if test.rotateAt.After(now) {
+			now = test.rotateAt.Add(-time.Minute)
+			lm.Write([]byte("early\n"))
+			if lm.CurrentFilename() != filename {
+				t.Errorf("Rotated at %s with a %s interval, expected %s", now, test.interval, test.rotateAt)
+			}
+			now = test.rotateAt.Add(time.Minute)
+		}
+		lm.Write([]byte("due\n"))
+		if lm.CurrentFilename() == filename {
+			t.Errorf("Didn't rotate at %s with a %s interval", now, test.interval)
+		}
+
+		lm.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		RotationInterval: time.Hour,
+	})
+
+	old := lm.currentFile.Name()
+
+	// Shorten the interval, it should take effect on the next write
+	err := lm.Reconfigure(LogManagerOptions{
+		RotationInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	lm.Write([]byte("test"))
+	if lm.currentFile.Name() == old {
+		t.Error("Log file did not rotate after shortening the interval")
+	}
+
+	// Defaults should still be applied
+	if lm.Options().FilenameFormat == "" {
+		t.Error("Default filename format was not applied")
+	}
+
+	// Invalid templates should be refused, and leave the old options in place
+	err = lm.Reconfigure(LogManagerOptions{
+		FilenameFormat: "{{ .Time",
+	})
+	if err == nil {
+		t.Error("Invalid filename format was accepted")
+	}
+	if lm.Options().RotationInterval != time.Millisecond {
+		t.Error("Options were changed by a failed reconfigure")
+	}
+
+	// Changing directories should be refused
+	err = lm.Reconfigure(LogManagerOptions{
+		Dir: filepath.Join(lm.options.Dir, "other"),
+	})
+	if err == nil {
+		t.Error("Directory change was accepted")
+	}
+
+	// So should starting a queue, which can only be done by reopening
+	err = lm.Reconfigure(LogManagerOptions{
+		AsyncQueue: 10,
+	})
+	if err == nil {
+		t.Error("AsyncQueue change was accepted")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestMaxIteration(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "test_{{ .Iteration }}.log",
+		MaxIteration:   5,
+	})
+
+	// Fill the directory up to just under the cap
+	for i := 1; i < 5; i++ {
+		err := os.WriteFile(filepath.Join(lm.options.Dir, fmt.Sprintf("test_%d.log", i)), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The last iteration is still free
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(lm.currentFile.Name()) != "test_5.log" {
+		t.Errorf("Rotated to %s instead of test_5.log", lm.currentFile.Name())
+	}
+
+	// Past the cap, rotating should fail cleanly and keep the current file
+	err = lm.Rotate()
+	if err == nil {
+		t.Error("Rotation past MaxIteration did not fail")
+	}
+	if filepath.Base(lm.currentFile.Name()) != "test_5.log" {
+		t.Error("Failed rotation changed the current file")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestAdoptFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The file to adopt isn't the newest one, so it wouldn't have been picked otherwise
+	legacy := filepath.Join(dir, "legacy.log")
+	os.WriteFile(legacy, []byte(strings.Repeat("x", 20)), 0644)
+	os.Chtimes(legacy, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	os.WriteFile(filepath.Join(dir, "other.log"), nil, 0644)
+
+	lm := NewLogManager(LogManagerOptions{Dir: dir, AdoptFile: "legacy.log", MaxFileSize: 30})
+	defer lm.Close()
+	if lm.CurrentFilename() != legacy {
+		t.Fatalf("Writing to %s instead of the adopted file", lm.CurrentFilename())
+	}
+
+	// Appends should go to the adopted file, until it's full
+	lm.Write([]byte("12345"))
+	lm.Write([]byte("1234567890"))
+	if lm.CurrentFilename() == legacy {
+		t.Error("Adopted file wasn't rotated once it was full")
+	}
+	b, err := os.ReadFile(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != strings.Repeat("x", 20)+"12345" {
+		t.Errorf("Adopted file contains %q", b)
+	}
+
+	// Adopting a file that isn't there should fail
+	err = New(LogManagerOptions{Dir: dir, AdoptFile: "missing.log"}).Open()
+	if err == nil {
+		t.Error("Adopting a missing file didn't fail")
+	}
+}
+
+func TestCompressAdopted(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir, err := os.MkdirTemp("", "logmanager_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacy := filepath.Join(dir, "legacy.log")
+		os.WriteFile(legacy, []byte("legacy\n"), 0644)
+
+		lm := NewLogManager(LogManagerOptions{
+			Dir:               dir,
+			FilenameFormat:    "{{ .Iteration }}.log",
+			AdoptFile:         "legacy.log",
+			GZIP:              true,
+			CompressionFormat: CompressGzip,
+			CompressAdopted:   compress,
+		})
+		lm.Rotate()
+
+		// Only the adopted file is exempt, the manager's own logs are still compressed
+		lm.Write([]byte("ours\n"))
+		own := lm.CurrentFilename()
+		lm.Rotate()
+		lm.Close()
+
+		_, err = os.Stat(legacy)
+		if compress == (err == nil) {
+			t.Errorf("With CompressAdopted %t, adopted file was left behind: %t", compress, err == nil)
+		}
+		_, err = os.Stat(filepath.Join(dir, "legacy.gz"))
+		if compress != (err == nil) {
+			t.Errorf("With CompressAdopted %t, adopted file was compressed: %t", compress, err == nil)
+		}
+		if _, err := os.Stat(own); !os.IsNotExist(err) {
+			t.Errorf("With CompressAdopted %t, %s wasn't compressed", compress, own)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFreshOnStart(t *testing.T) {
+	lm := setup(LogManagerOptions{FilenameFormat: "run_{{ .Iteration }}.log"})
+	lm.Write([]byte("first run"))
+	previous := lm.CurrentFilename()
+	lm.Close()
+
+	options := lm.options
+	options.FreshOnStart = true
+	lm = NewLogManager(options)
+	defer lm.Close()
+	if lm.CurrentFilename() == previous {
+		t.Fatal("Carried on with the previous run's log")
+	}
+	lm.Write([]byte("second run"))
+
+	b, err := os.ReadFile(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first run" {
+		t.Errorf("Previous run's log contains %q", b)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestLazyCreate(t *testing.T) {
+	lm := setup(LogManagerOptions{LazyCreate: true, Header: "# app v1\n", MaxFileSize: 20})
+
+	// Nothing should be created until there's something to write
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Found %d files before the first write", len(entries))
+	}
+	if err := lm.Healthy(); err != nil {
+		t.Errorf("Waiting on the first write is unhealthy: %s", err)
+	}
+
+	// The header goes first, then the write, and both count towards the size
+	lm.Write([]byte("hello\n"))
+	first := lm.CurrentFilename()
+	b, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "# app v1\nhello\n" {
+		t.Errorf("First log contains %q", b)
+	}
+	if size := lm.Stats().CurrentFileSize; size != int64(len(b)) {
+		t.Errorf("Current file size is %d, expected %d", size, len(b))
+	}
+	lm.Write([]byte("world\n"))
+	if lm.CurrentFilename() == first {
+		t.Error("Header wasn't counted towards MaxFileSize")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+
+	// Closing without ever writing leaves nothing behind
+	lm = setup(LogManagerOptions{LazyCreate: true})
+	err = lm.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(lm.options.Dir); len(entries) != 0 {
+		t.Errorf("Found %d files after closing without writing", len(entries))
+	}
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestLazyCreatePending(t *testing.T) {
+	// Bundling on Close shouldn't trip over there being no current log yet
+	lm := setup(LogManagerOptions{LazyCreate: true, BundleOnClose: true})
+	if err := lm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(lm.options.Dir)
+
+	// Everything that needs the current log should create it, rather than act like we're closed
+	for name, call := range map[string]func(lm *LogManager) error{
+		"Follow": func(lm *LogManager) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			_, err := lm.Follow(ctx)
+			return err
+		},
+		"Compact":       func(lm *LogManager) error { return lm.Compact(10) },
+		"RefreshLatest": func(lm *LogManager) error { return lm.RefreshLatest() },
+		"MigrateDir":    func(lm *LogManager) error { return lm.MigrateDir(t.TempDir()) },
+	} {
+		lm := setup(LogManagerOptions{LazyCreate: true, LatestDotLog: true})
+		if err := call(lm); err != nil {
+			t.Errorf("%s failed before the first write: %s", name, err)
+		}
+		if lm.CurrentFilename() == "" {
+			t.Errorf("%s didn't create the log", name)
+		}
+		lm.Close()
+		os.RemoveAll(lm.options.Dir)
+	}
+}
+
+func TestStartIteration(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "foo_{{ .Iteration }}.log",
+		StartIteration: 100,
+	})
+	if filepath.Base(lm.CurrentFilename()) != "foo_100.log" {
+		t.Errorf("First file is %s, expected foo_100.log", lm.CurrentFilename())
+	}
+	os.RemoveAll(lm.options.Dir)
+
+	// Migrating from another logger, which left a gap in its iterations
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= 42; i++ {
+		if i >= 10 && i < 20 {
+			continue
+		}
+		err = os.WriteFile(filepath.Join(dir, fmt.Sprintf("foo_%d.log", i)), []byte("old"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rotations should carry on from the highest iteration, rather than filling in the gap
+	lm = NewLogManager(LogManagerOptions{Dir: dir, FilenameFormat: "foo_{{ .Iteration }}.log"})
+	err = lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(lm.CurrentFilename()) != "foo_43.log" {
+		t.Errorf("Rotated to %s, expected foo_43.log", lm.CurrentFilename())
+	}
+
+	os.RemoveAll(dir)
+}
+
+func TestCompressAtomic(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a large enough log that compressing it takes a moment
+	fn := filepath.Join(dir, "test.log")
+	err = os.WriteFile(fn, bytes.Repeat([]byte("test\n"), 1<<20), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Watch for the archive while it's being written
+	dest := filepath.Join(dir, "test.tar.gz")
+	done := make(chan error)
+	lm := &LogManager{fs: osFS{}}
+	go func() { done <- lm.compress(context.Background(), fn, dest) }()
+	for finished := false; !finished; {
+		select {
+		case err = <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			finished = true
+		default:
+		}
+
+		// If the archive is visible at all, it must be complete
+		f, err := os.Open(dest)
+		if err != nil {
+			continue
+		}
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gr)
+		if _, err = tr.Next(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.Copy(io.Discard, tr); err != nil {
+			t.Fatalf("Archive was visible before it was fully written: %v", err)
+		}
+		f.Close()
+	}
+
+	// A failed archive shouldn't leave anything behind
+	err = lm.archive(context.Background(), filepath.Join(dir, "failed.tar.gz"), CompressTarGz, fn, filepath.Join(dir, "missing.log"))
+	if err == nil {
+		t.Fatal("Archiving a missing file did not fail")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected only the log and its archive, found %d files", len(entries))
+	}
+
+	os.RemoveAll(dir)
+}
+
+func TestWriteAll(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		MaxFileSize: 10,
+	})
+
+	old := lm.currentFile.Name()
+
+	// The batch doesn't fit in one file, so it should get split across a rotation
+	n, err := lm.WriteAll([][]byte{[]byte("1234"), []byte("5678"), []byte("abcd")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 12 {
+		t.Errorf("Expected 12 bytes written, got %d", n)
+	}
+
+	b, err := os.ReadFile(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "12345678" {
+		t.Errorf("First file contains %q", b)
+	}
+	b, err = os.ReadFile(lm.currentFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "abcd" {
+		t.Errorf("Second file contains %q", b)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func BenchmarkWrite(b *testing.B) {
+	lm := setup(LogManagerOptions{})
+	line := []byte("benchmark log line\n")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			lm.Write(line)
+		}
+	}
+	b.StopTimer()
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func BenchmarkAppendRaw(b *testing.B) {
+	lm := setup(LogManagerOptions{})
+	line := []byte("benchmark log line\n")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			lm.AppendRaw(line)
+		}
+	}
+	b.StopTimer()
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func BenchmarkWriteAll(b *testing.B) {
+	lm := setup(LogManagerOptions{})
+	lines := make([][]byte, 100)
+	for i := range lines {
+		lines[i] = []byte("benchmark log line\n")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lm.WriteAll(lines)
+	}
+	b.StopTimer()
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func BenchmarkRotateGZIP(b *testing.B) {
+	lm := setup(LogManagerOptions{GZIP: true})
+	line := []byte(strings.Repeat("benchmark log line\n", 1000))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lm.Write(line)
+		lm.Rotate()
+	}
+	b.StopTimer()
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestArchiveDir(t *testing.T) {
+	archiveDir, err := os.MkdirTemp("", "logmanager_test_archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm := setup(LogManagerOptions{
+		GZIP:       true,
+		ArchiveDir: archiveDir,
+	})
+
+	old := lm.currentFile.Name()
+	err = lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the archive landed in the archive directory
+	archived := filepath.Join(archiveDir, strings.TrimSuffix(filepath.Base(old), ".log")+".tar.gz")
+	if _, err := os.Stat(archived); err != nil {
+		t.Error(err)
+	}
+
+	// Check that neither the original nor the archive is left in the log directory
+	if _, err := os.Stat(old); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Old log file was not deleted")
+	}
+	if _, err := os.Stat(strings.TrimSuffix(old, ".log") + ".tar.gz"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Archive was written to the log directory")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+	os.RemoveAll(archiveDir)
+}
+
+func TestWriteBOM(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		WriteBOM:    true,
+		MaxFileSize: 10,
+	})
+
+	lm.Write([]byte("test"))
+
+	b, err := os.ReadFile(lm.currentFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte("\xEF\xBB\xBFtest")) {
+		t.Errorf("File starts with %q instead of a BOM", b)
+	}
+
+	// The BOM counts towards the file size, so this should rotate (3 + 4 + 3 >= 10)
+	old := lm.currentFile.Name()
+	lm.Write([]byte("123"))
+	if lm.currentFile.Name() == old {
+		t.Error("BOM was not included in the file size")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestExcludeOverhead(t *testing.T) {
+	// Without the option, the header counts towards the file size
+	lm := setup(LogManagerOptions{Header: "# app v1\n", MaxFileSize: 10})
+	old := lm.currentFile.Name()
+	lm.Write([]byte("12345678"))
+	if lm.currentFile.Name() == old {
+		t.Error("Header was not included in the file size")
+	}
+	os.RemoveAll(lm.options.Dir)
+
+	// With it, only what's written to us counts
+	lm = setup(LogManagerOptions{Header: "# app v1\n", MaxFileSize: 10, ExcludeOverhead: true})
+	old = lm.currentFile.Name()
+	lm.Write([]byte("12345678"))
+	lm.Write([]byte("9"))
+	if lm.currentFile.Name() != old {
+		t.Error("Header was included in the file size")
+	}
+	lm.Write([]byte("0"))
+	if lm.currentFile.Name() == old {
+		t.Error("File didn't rotate once it was full")
+	}
+
+	// Every new file should still get the header
+	for _, fn := range []string{old, lm.currentFile.Name()} {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(b), "# app v1\n") {
+			t.Errorf("%s starts with %q instead of the header", fn, b)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestFilenameOutsideDir(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+	old := lm.currentFile.Name()
+
+	for _, format := range []string{"/etc/passwd", "../../x.log", "logs/../../x.log", ""} {
+		err := lm.Reconfigure(LogManagerOptions{
+			FilenameFormat: format + "{{ if .Iteration }}{{ end }}",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = lm.Rotate()
+		if err == nil {
+			t.Errorf("Filename %q was not refused", format)
+		}
+		if lm.currentFile.Name() != old {
+			t.Errorf("Filename %q changed the current file", format)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestCurrentFilename(t *testing.T) {
+	var r Rotator = setup(LogManagerOptions{})
+	lm := r.(*LogManager)
+
+	if r.CurrentFilename() != lm.currentFile.Name() {
+		t.Error("CurrentFilename does not match the current file")
+	}
+
+	err := r.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CurrentFilename() != lm.currentFile.Name() {
+		t.Error("CurrentFilename does not match the current file after rotating")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestRotateOnNameChange(t *testing.T) {
+	now := time.Date(2022, 5, 17, 23, 55, 0, 0, time.UTC)
+	lm := setup(LogManagerOptions{
+		FilenameFormat:     `{{ .Time.Format "2006-01-02" }}.log`,
+		RotateOnNameChange: true,
+		Now:                func() time.Time { return now },
+	})
+
+	lm.Write([]byte("before midnight"))
+
+	// Nothing gets written across midnight, then a write arrives the next day
+	now = now.Add(time.Minute * 10)
+	lm.Write([]byte("after midnight"))
+
+	if filepath.Base(lm.currentFile.Name()) != "2022-05-18.log" {
+		t.Errorf("Write after midnight went to %s", lm.currentFile.Name())
+	}
+	for name, want := range map[string]string{"2022-05-17.log": "before midnight", "2022-05-18.log": "after midnight"} {
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", name, b, want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestMaxWrites(t *testing.T) {
+	lm := setup(LogManagerOptions{MaxWrites: 3})
+
+	for i := 0; i < 9; i++ {
+		lm.Write([]byte{byte('a' + i)})
+	}
+
+	// Every 3 writes should have gone to their own file
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, entry := range entries {
+		if isReserved(entry.Name()) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, string(b))
+	}
+	if strings.Join(contents, ",") != "abc,def,ghi" {
+		t.Errorf("Files contain %v, expected [abc def ghi]", contents)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestStartupGrace(t *testing.T) {
+	now := time.Date(2022, 5, 17, 12, 0, 0, 0, time.UTC)
+	lm := setup(LogManagerOptions{
+		MaxFileSize:  10,
+		StartupGrace: time.Second * 5,
+		Now:          func() time.Time { return now },
+	})
+
+	// The startup burst should all land in the first file
+	first := lm.currentFile.Name()
+	for i := 0; i < 3; i++ {
+		lm.Write([]byte("startup banner"))
+	}
+	if lm.currentFile.Name() != first {
+		t.Errorf("Rotated during the startup grace period")
+	}
+
+	// Once the grace period is over, size rotations should resume
+	now = now.Add(time.Second * 5)
+	lm.Write([]byte("after startup"))
+	if lm.currentFile.Name() == first {
+		t.Errorf("Didn't rotate after the startup grace period")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestRotationMarker(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		RotationMarker: `=== rotated to {{ .Time.Format "2006" }} from {{ .Previous }} ===`,
+	})
+
+	lm.Write([]byte("line\n"))
+	old := lm.currentFile.Name()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("line\n=== rotated to %d from %s ===\n", time.Now().Year(), filepath.Base(old))
+	if string(b) != want {
+		t.Errorf("Rotated file contains %q, expected %q", b, want)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestOversizedWrites(t *testing.T) {
+	big := []byte(strings.Repeat("0123456789", 3) + "abcde")
+
+	// Rejected writes shouldn't write anything
+	lm := setup(LogManagerOptions{MaxFileSize: 10, OversizedWrites: OversizeReject})
+	n, err := lm.Write(big)
+	if !errors.Is(err, ErrWriteTooLarge) || n != 0 {
+		t.Errorf("Oversized write wasn't rejected, wrote %d bytes (%v)", n, err)
+	}
+	os.RemoveAll(lm.options.Dir)
+
+	// Split writes should fill up as many files as they need
+	lm = setup(LogManagerOptions{MaxFileSize: 10, OversizedWrites: OversizeSplit})
+	n, err = lm.Write(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(big) {
+		t.Errorf("Wrote %d bytes, expected %d", n, len(big))
+	}
+
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var joined []byte
+	var logs int
+	for _, entry := range entries {
+		if isReserved(entry.Name()) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > 10 {
+			t.Errorf("%s is %d bytes, over the max file size", entry.Name(), len(b))
+		}
+		joined = append(joined, b...)
+		logs++
+	}
+	if logs != 4 {
+		t.Errorf("Expected the write to be split across 4 files, found %d", logs)
+	}
+	if string(joined) != string(big) {
+		t.Errorf("Split files contain %q, expected %q", joined, big)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestSnapshot(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+	lm.Write([]byte("before "))
+
+	dest := filepath.Join(lm.options.Dir, "snapshot.bak")
+	err := lm.Snapshot(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "before " {
+		t.Errorf("Snapshot contains %q, expected %q", b, "before ")
+	}
+
+	// Logging should carry on in the same file, where it left off
+	name := lm.CurrentFilename()
+	lm.Write([]byte("after"))
+	if lm.CurrentFilename() != name {
+		t.Error("Snapshot rotated the log file")
+	}
+	b, err = os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "before after" {
+		t.Errorf("Log contains %q, expected %q", b, "before after")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestWriteTo(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+	content := strings.Repeat("streamed line\n", 10000)
+	lm.Write([]byte(content))
+
+	var buf bytes.Buffer
+	n, err := lm.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(content)) || buf.String() != content {
+		t.Errorf("Wrote %d bytes, expected the %d in the log", n, len(content))
+	}
+
+	// Logging should carry on where it left off
+	lm.Write([]byte("after\n"))
+	b, err := os.ReadFile(lm.CurrentFilename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content+"after\n" {
+		t.Error("WriteTo disturbed the log file")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestExpandEnv(t *testing.T) {
+	base, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	t.Setenv("LOGMANAGER_TEST_DIR", base)
+	t.Setenv("LOGMANAGER_TEST_APP", "app")
+	os.Unsetenv("LOGMANAGER_TEST_UNSET")
+
+	lm := NewLogManager(LogManagerOptions{
+		Dir:            "$LOGMANAGER_TEST_DIR/logs",
+		FilenameFormat: `${LOGMANAGER_TEST_APP}${LOGMANAGER_TEST_UNSET}-{{ $t := .Time }}{{ $t.Format "2006" }}.log`,
+		ExpandEnv:      true,
+	})
+	defer lm.Close()
+
+	// Unset variables expand to nothing, and template variables are left for the template
+	want := filepath.Join(base, "logs", fmt.Sprintf("app-%d.log", time.Now().Year()))
+	if lm.CurrentFilename() != want {
+		t.Errorf("Logging to %s, expected %s", lm.CurrentFilename(), want)
+	}
+}
+
+func TestCollisionResolver(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "app.log",
+		CollisionResolver: func(base string, attempt uint) string {
+			token := make([]byte, 4)
+			rand.Read(token)
+			return strings.TrimSuffix(base, ".log") + "-" + hex.EncodeToString(token) + ".log"
+		},
+	})
+
+	// Every rotation should get a new name, without colliding
+	seen := map[string]bool{lm.currentFile.Name(): true}
+	for i := 0; i < 10; i++ {
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[lm.currentFile.Name()] {
+			t.Fatalf("Rotated to %s, which already existed", lm.currentFile.Name())
+		}
+		if !regexp.MustCompile(`^app-[0-9a-f]{8}\.log$`).MatchString(filepath.Base(lm.currentFile.Name())) {
+			t.Errorf("Filename %s was not produced by the resolver", lm.currentFile.Name())
+		}
+		seen[lm.currentFile.Name()] = true
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestAfterCompress(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		var mu sync.Mutex
+		calls := map[string]int{}
+
+		lm := setup(LogManagerOptions{
+			FilenameFormat: `{{ .Time.Format "150405.000000000" }}.log`,
+			GZIP:           true,
+			AsyncCompress:  async,
+			AfterCompress: func(archivePath string, err error) {
+				if err != nil {
+					t.Error(err)
+				}
+				mu.Lock()
+				calls[archivePath]++
+				mu.Unlock()
+			},
+		})
+
+		var expected []string
+		for i := 0; i < 3; i++ {
+			lm.Write([]byte("test"))
+			expected = append(expected, strings.TrimSuffix(lm.currentFile.Name(), ".log")+".tar.gz")
+			err := lm.Rotate()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Close waits for background compressions
+		err := lm.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, archive := range expected {
+			if calls[archive] != 1 {
+				t.Errorf("AfterCompress was called %d times for %s (async: %v)", calls[archive], archive, async)
+			}
+			if _, err := os.Stat(archive); err != nil {
+				t.Errorf("Archive missing when AfterCompress was called: %v", err)
+			}
+		}
+		if len(calls) != len(expected) {
+			t.Errorf("AfterCompress was called for %d archives, expected %d (async: %v)", len(calls), len(expected), async)
+		}
+
+		os.RemoveAll(lm.options.Dir)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	lm := setup(LogManagerOptions{FilenameFormat: "{{ .Iteration }}.log"})
+	logger := lm.StdLogger("app: ", 0)
+
+	logger.Print("first")
+	first := lm.CurrentFilename()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Print("second")
+
+	for filename, want := range map[string]string{first: "app: first\n", lm.CurrentFilename(): "app: second\n"} {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", filepath.Base(filename), b, want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestOnDrop(t *testing.T) {
+	var dropped []string
+	var errs []error
+	lm := setup(LogManagerOptions{
+		OnDrop: func(p []byte, err error) {
+			dropped = append(dropped, string(p))
+			errs = append(errs, err)
+		},
+	})
+
+	lm.Write([]byte("kept\n"))
+	if len(dropped) != 0 {
+		t.Fatalf("Dropped %q after a successful write", dropped)
+	}
+
+	// Make the next writes fail
+	lm.currentFile.Close()
+	_, err := lm.Write([]byte("lost\n"))
+	if err == nil {
+		t.Fatal("Write didn't fail")
+	}
+	lm.WriteAll([][]byte{[]byte("also\n"), []byte("lost\n")})
+
+	want := []string{"lost\n", "also\n", "lost\n"}
+	if strings.Join(dropped, "") != strings.Join(want, "") || len(dropped) != len(want) {
+		t.Errorf("Dropped %q, expected %q", dropped, want)
+	}
+	if len(errs) == 0 || errs[0] != err {
+		t.Errorf("Dropped with %v, expected %v", errs, err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestProbeSkipsArchivedNames(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "app_{{ .Iteration }}.log",
+		GZIP:           true,
+	})
+
+	// Only the archive of the next name is left, e.g. from a previous run
+	archive := filepath.Join(lm.options.Dir, "app_1.tar.gz")
+	err := os.WriteFile(archive, []byte("old"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := filepath.Base(lm.CurrentFilename()); name == "app_1.log" {
+			t.Errorf("Rotated to %s, which has already been archived", name)
+		}
+	}
+
+	b, err := os.ReadFile(archive)
+	if err != nil || string(b) != "old" {
+		t.Errorf("Old archive was overwritten: %q (%v)", b, err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestAppendRaw(t *testing.T) {
+	lm := setup(LogManagerOptions{MaxFileSize: 4})
+	current := lm.CurrentFilename()
+
+	// Way over MaxFileSize, but AppendRaw leaves rotating up to us
+	for i := 0; i < 3; i++ {
+		_, err := lm.AppendRaw([]byte("raw line\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lm.CurrentFilename() != current {
+		t.Errorf("AppendRaw rotated to %s", lm.CurrentFilename())
+	}
+	b, err := os.ReadFile(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("raw line\n", 3); string(b) != want {
+		t.Errorf("Log contains %q, expected %q", b, want)
+	}
+
+	// Write still enforces it
+	lm.Write([]byte("checked\n"))
+	if lm.CurrentFilename() == current {
+		t.Error("Write didn't rotate the oversized log")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestFilenameTimeFunc(t *testing.T) {
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.UTC)
+	event := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	lm := setup(LogManagerOptions{
+		RotationInterval: time.Hour,
+		Now:              func() time.Time { return now },
+		FilenameTimeFunc: func() time.Time { return event },
+	})
+	if name := filepath.Base(lm.CurrentFilename()); name != "2000-01-01_0.log" {
+		t.Errorf("First log is %s, expected 2000-01-01_0.log", name)
+	}
+
+	// The event time jumping ahead shouldn't cause a rotation, only the main clock should
+	event = event.Add(48 * time.Hour)
+	now = now.Add(30 * time.Minute)
+	lm.Write([]byte("line\n"))
+	if name := filepath.Base(lm.CurrentFilename()); name != "2000-01-01_0.log" {
+		t.Errorf("Rotated to %s before the interval was up", name)
+	}
+
+	now = now.Add(time.Hour)
+	lm.Write([]byte("line\n"))
+	if name := filepath.Base(lm.CurrentFilename()); name != "2000-01-03_0.log" {
+		t.Errorf("Rotated to %s, expected 2000-01-03_0.log", name)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestShouldRotate(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "{{ .Iteration }}.log",
+		ShouldRotate: func(currentSize int64, age time.Duration, pending []byte) bool {
+			return currentSize > 0 && bytes.HasPrefix(pending, []byte("=== "))
+		},
+	})
+
+	for _, line := range []string{"=== one\n", "a\n", "b\n", "=== two\n", "c\n"} {
+		lm.Write([]byte(line))
+	}
+
+	// Each section should start a new file
+	for name, want := range map[string]string{"0.log": "=== one\na\nb\n", "1.log": "=== two\nc\n"} {
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", name, b, want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestSkipEmptyRotation(t *testing.T) {
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		FilenameFormat:    "{{ .Iteration }}.log",
+		Header:            "# app v1\n",
+		RotationInterval:  time.Hour,
+		SkipEmptyRotation: true,
+		Now:               func() time.Time { return now },
+	})
+
+	// Nothing was written for the first interval, so the first write should land in the same file
+	now = now.Add(2 * time.Hour)
+	lm.Write([]byte("a\n"))
+	lm.Write([]byte("b\n"))
+	if filepath.Base(lm.CurrentFilename()) != "0.log" {
+		t.Errorf("Empty file was rotated to %s", lm.CurrentFilename())
+	}
+
+	// Once the file has something in it, it rotates as usual
+	now = now.Add(2 * time.Hour)
+	lm.Write([]byte("c\n"))
+	for name, want := range map[string]string{"0.log": "# app v1\na\nb\n", "1.log": "# app v1\nc\n"} {
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", name, b, want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestMinRotationInterval(t *testing.T) {
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		FilenameFormat:      "{{ .Iteration }}.log",
+		MaxFileSize:         1,
+		MinRotationInterval: time.Minute,
+		Now:                 func() time.Time { return now },
+	})
+
+	// Every write is over the max file size, but none of them can rotate yet
+	opened := lm.Stats().Rotations
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		lm.Write([]byte(line))
+	}
+	if rotations := lm.Stats().Rotations - opened; rotations != 0 {
+		t.Errorf("Rotated %d times within the min rotation interval", rotations)
+	}
+
+	// Once it's passed, the next write rotates, and the one after that waits again
+	now = now.Add(time.Minute)
+	lm.Write([]byte("d\n"))
+	lm.Write([]byte("e\n"))
+	for name, want := range map[string]string{"0.log": "a\nb\nc\n", "1.log": "d\ne\n"} {
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", name, b, want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestRotateDebounce(t *testing.T) {
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "{{ .Iteration }}.log",
+		RotateDebounce: time.Second,
+		Now:            func() time.Time { return now },
+	})
+
+	// A burst of rotations should only start one new file
+	now = now.Add(time.Minute)
+	opened := lm.Stats().Rotations
+	for i := 0; i < 5; i++ {
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Millisecond * 100)
+	}
+	if rotations := lm.Stats().Rotations - opened; rotations != 1 {
+		t.Errorf("Rotated %d times within the debounce, expected 1", rotations)
+	}
+	if name := filepath.Base(lm.CurrentFilename()); name != "1.log" {
+		t.Errorf("Current log is %s, expected 1.log", name)
+	}
+
+	// Once it's passed, the next one goes ahead
+	now = now.Add(time.Second)
+	lm.Rotate()
+	if rotations := lm.Stats().Rotations - opened; rotations != 2 {
+		t.Errorf("Rotated %d times, expected 2", rotations)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestRotateDebounceSize(t *testing.T) {
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "{{ .Iteration }}.log",
+		MaxFileSize:    1,
+		RotateDebounce: time.Second,
+		Now:            func() time.Time { return now },
+	})
+
+	// Every write is over the max file size, but only the first can rotate within the debounce
+	now = now.Add(time.Minute)
+	opened := lm.Stats().Rotations
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		lm.Write([]byte(line))
+		now = now.Add(time.Millisecond * 100)
+	}
+	if rotations := lm.Stats().Rotations - opened; rotations != 1 {
+		t.Errorf("Rotated %d times within the debounce, expected 1", rotations)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestMinRotationIntervalSchedule(t *testing.T) {
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		FilenameFormat:      "{{ .Iteration }}.log",
+		RotationInterval:    time.Minute,
+		MinRotationInterval: time.Hour,
+		Now:                 func() time.Time { return now },
+	})
+
+	// The interval asked for its own rotations, so the min rotation interval doesn't hold them off
+	opened := lm.Stats().Rotations
+	now = now.Add(2 * time.Minute)
+	lm.Write([]byte("a\n"))
+	if rotations := lm.Stats().Rotations - opened; rotations != 1 {
+		t.Errorf("Rotated %d times, expected the interval to rotate once", rotations)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestEnsureTrailingNewline(t *testing.T) {
+	lm := setup(LogManagerOptions{FilenameFormat: "{{ .Iteration }}.log", EnsureTrailingNewline: true, RotationMarker: "-- end --"})
+
+	// Unfinished lines should be finished off by rotating and closing, finished ones left alone
+	lm.Write([]byte("unfinished"))
+	lm.Rotate()
+	lm.Write([]byte("finished\n"))
+	lm.Rotate()
+	lm.Write([]byte("closed"))
+	lm.Close()
+
+	for name, want := range map[string]string{"0.log": "unfinished\n-- end --\n", "1.log": "finished\n-- end --\n", "2.log": "closed\n"} {
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", name, b, want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestTempSuffix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Temp files left behind by a crash are newer than the log they'd have replaced
+	current := filepath.Join(dir, "app.log")
+	os.WriteFile(current, []byte("log\n"), 0644)
+	os.Chtimes(current, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	for _, name := range []string{".app.log.123.partial", ".app.tar.gz.456.partial"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("partial"), 0644)
+	}
+
+	lm := NewLogManager(LogManagerOptions{Dir: dir, FilenameFormat: "app.log", TempSuffix: ".partial", GZIP: true})
+	defer lm.Close()
+	if lm.CurrentFilename() != current {
+		t.Errorf("Carried on with %s instead of the newest log", lm.CurrentFilename())
+	}
+
+	// They aren't backups either
+	found, err := lm.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range found {
+		if strings.HasSuffix(b.path, ".partial") {
+			t.Errorf("Temp file %s was counted as a backup", b.path)
+		}
+	}
+
+	// And new temp files get the suffix too
+	if pattern := lm.tempPattern(current); pattern != ".app.log.*.partial" {
+		t.Errorf("Temp files are named like %s", pattern)
+	}
+}
+
+func TestTmpFilenameFormat(t *testing.T) {
+	// A log that happens to end in .tmp is still a log, not a temp file
+	lm := setup(LogManagerOptions{FilenameFormat: "app.tmp"})
+	lm.Write([]byte("first\n"))
+	lm.Close()
+
+	lm = NewLogManager(lm.options)
+	defer lm.Close()
+	if filepath.Base(lm.CurrentFilename()) != "app.tmp" {
+		t.Fatalf("Carried on with %q, expected app.tmp", lm.CurrentFilename())
+	}
+	if _, err := lm.Write([]byte("second\n")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(lm.options.Dir, "app.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first\nsecond\n" {
+		t.Errorf("app.tmp contains %q", b)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestWriteDuringClose(t *testing.T) {
+	lm := setup(LogManagerOptions{MaxFileSize: 1000})
+
+	var written int64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for j := 0; j < 200; j++ {
+				_, err := lm.Write([]byte("test\n"))
+				switch {
+				case err == nil:
+					mu.Lock()
+					written++
+					mu.Unlock()
+				case !errors.Is(err, os.ErrClosed):
+					t.Errorf("Write during Close failed with %v, expected os.ErrClosed", err)
+					return
+				}
+			}
+		}()
+	}
+	// Rotations shouldn't be able to start background work while Close waits on it
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for j := 0; j < 50; j++ {
+				err := lm.Rotate()
+				if err != nil && !errors.Is(err, os.ErrClosed) {
+					t.Errorf("Rotate during Close failed with %v, expected os.ErrClosed", err)
+					return
+				}
+			}
+		}()
+	}
+
+	close(start)
+	time.Sleep(time.Millisecond)
+	if err := lm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if _, err := lm.Write([]byte("test\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write after Close returned %v, expected os.ErrClosed", err)
+	}
+	if err := lm.Rotate(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Rotate after Close returned %v, expected os.ErrClosed", err)
+	}
+
+	// Every write that succeeded should've made it into a file, and nothing else
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines int64
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join(lm.options.Dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines += int64(bytes.Count(b, []byte("\n")))
+	}
+	if lines != written {
+		t.Errorf("Expected %d lines in the log files, found %d", written, lines)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
@@ -0,0 +1,94 @@
+package logmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifestName is the name of the manifest file kept in the log directory when WriteManifest is set
+const manifestName = "manifest.json"
+
+// Manifest is the format of manifest.json, listing every rotation the log manager has performed
+type Manifest struct {
+	Rotations []ManifestEntry `json:"rotations"`
+}
+
+// ManifestEntry describes a single rotated log
+type ManifestEntry struct {
+	Time       time.Time `json:"time"`
+	Filename   string    `json:"filename"`
+	Size       int64     `json:"size"`
+	Compressed bool      `json:"compressed"`
+}
+
+// readManifest is a helper function that reads the manifest in the log directory, if there is one
+func (lm *LogManager) readManifest() (m Manifest, err error) {
+	b, err := os.ReadFile(filepath.Join(lm.options.Dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &m)
+	return
+}
+
+// writeManifest is a helper function that atomically replaces the manifest in the log directory
+func (lm *LogManager) writeManifest(m Manifest) (err error) {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return
+	}
+
+	// Write to a temp file first, then rename it over the old manifest, so readers never see a partial manifest
+	tmp, err := os.CreateTemp(lm.options.Dir, manifestName+".*"+lm.options.TempSuffix)
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if err != nil {
+		tmp.Close()
+		return
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return
+	}
+
+	return replaceFile(tmp.Name(), filepath.Join(lm.options.Dir, manifestName))
+}
+
+// recordRotation is a helper function that adds the rotated log at filename to the manifest
+func (lm *LogManager) recordRotation(filename string, t time.Time) (err error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+
+	rel, err := filepath.Rel(lm.options.Dir, filename)
+	if err != nil {
+		return
+	}
+
+	m, err := lm.readManifest()
+	if err != nil {
+		return fmt.Errorf("unable to read manifest: %w", err)
+	}
+
+	m.Rotations = append(m.Rotations, ManifestEntry{
+		Time:       t,
+		Filename:   rel,
+		Size:       info.Size(),
+		Compressed: isArchive(filename),
+	})
+
+	return lm.writeManifest(m)
+}
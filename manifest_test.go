@@ -0,0 +1,88 @@
+package logmanager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		WriteManifest: true,
+		GZIP:          true,
+	})
+
+	// Rotate a couple of times
+	var rotated []string
+	for i := 0; i < 2; i++ {
+		lm.Write([]byte("test"))
+		rotated = append(rotated, filepath.Base(archiveName(lm.currentFile.Name(), CompressTarGz)))
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := lm.readManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Rotations) != len(rotated) {
+		t.Fatalf("Expected %d rotations in manifest, found %d", len(rotated), len(m.Rotations))
+	}
+	for i, entry := range m.Rotations {
+		if entry.Filename != rotated[i] {
+			t.Errorf("Expected %s in manifest, found %s", rotated[i], entry.Filename)
+		}
+		if !entry.Compressed || entry.Size == 0 {
+			t.Errorf("Manifest entry for %s is incorrect", entry.Filename)
+		}
+	}
+
+	// Check that no temp files were left behind
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("Temp file %s was left behind", entry.Name())
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestManifestIgnoredOnResume(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		WriteManifest: true,
+	})
+
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := lm.currentFile.Name()
+	lm.Close()
+
+	// Make sure the manifest is the newest file in the directory
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(filepath.Join(lm.options.Dir, manifestName), future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The manifest shouldn't be picked up as a log
+	lm = NewLogManager(LogManagerOptions{
+		Dir:           lm.options.Dir,
+		WriteManifest: true,
+	})
+	if lm.currentFile.Name() != active {
+		t.Errorf("Resumed %s instead of %s", lm.currentFile.Name(), active)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
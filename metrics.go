@@ -0,0 +1,95 @@
+package logmanager
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// counters holds the log manager's running statistics. Fields are accessed atomically.
+type counters struct {
+	rotations         uint64
+	bytesWritten      uint64
+	compressionErrors uint64
+	currentFileSize   int64
+	lastRotation      int64  // Nanoseconds
+	maxRotation       int64  // Nanoseconds
+	writeRate         uint64 // Bytes per second as of rateUpdated, as math.Float64bits
+	rateUpdated       int64  // Unix nanoseconds, by Now
+	rateWindow        int64  // RateWindow, since Stats needs it outside the lock
+}
+
+// Stats is a snapshot of the log manager's running statistics
+type Stats struct {
+	Rotations         uint64
+	BytesWritten      uint64
+	CompressionErrors uint64
+	CurrentFileSize   int64
+	WriteRate         float64 // Bytes per second, averaged over RateWindow
+
+	// How long the most recent and the slowest rotation took, including compression
+	LastRotationDuration time.Duration
+	MaxRotationDuration  time.Duration
+}
+
+// Stats returns a snapshot of the log manager's running statistics. It doesn't wait on rotations.
+func (lm *LogManager) Stats() Stats {
+	now, _ := lm.now.Load().(func() time.Time)
+	if now == nil {
+		now = time.Now
+	}
+
+	return Stats{
+		Rotations:         atomic.LoadUint64(&lm.stats.rotations),
+		BytesWritten:      atomic.LoadUint64(&lm.stats.bytesWritten),
+		CompressionErrors: atomic.LoadUint64(&lm.stats.compressionErrors),
+		CurrentFileSize:   atomic.LoadInt64(&lm.stats.currentFileSize),
+		WriteRate:         lm.writeRate(now()),
+
+		LastRotationDuration: time.Duration(atomic.LoadInt64(&lm.stats.lastRotation)),
+		MaxRotationDuration:  time.Duration(atomic.LoadInt64(&lm.stats.maxRotation)),
+	}
+}
+
+// recordRotationDuration is a helper function that keeps track of how long rotations take, warning about slow ones.
+// The lock must already be held.
+func (lm *LogManager) recordRotationDuration(d time.Duration) {
+	atomic.StoreInt64(&lm.stats.lastRotation, int64(d))
+	if int64(d) > atomic.LoadInt64(&lm.stats.maxRotation) {
+		atomic.StoreInt64(&lm.stats.maxRotation, int64(d))
+	}
+
+	if lm.options.SlowRotationThreshold > 0 && d > lm.options.SlowRotationThreshold {
+		lm.logf("warning: rotation took %s, longer than the %s threshold", d, lm.options.SlowRotationThreshold)
+	}
+}
+
+// MetricsRegisterer is implemented by an adapter for a metrics library (e.g. Prometheus), so that
+// this package doesn't have to depend on one. Each metric is read by calling value whenever it's collected.
+type MetricsRegisterer interface {
+	RegisterCounter(name, help string, value func() float64) error
+	RegisterGauge(name, help string, value func() float64) error
+}
+
+// RegisterCollectors registers the log manager's metrics with reg
+func (lm *LogManager) RegisterCollectors(reg MetricsRegisterer) (err error) {
+	counters := []struct {
+		name, help string
+		value      func() float64
+	}{
+		{"logmanager_rotations_total", "Total number of log rotations.", func() float64 { return float64(lm.Stats().Rotations) }},
+		{"logmanager_bytes_written_total", "Total number of bytes written to logs.", func() float64 { return float64(lm.Stats().BytesWritten) }},
+		{"logmanager_compression_errors_total", "Total number of failed log compressions.", func() float64 { return float64(lm.Stats().CompressionErrors) }},
+	}
+	for _, c := range counters {
+		err = reg.RegisterCounter(c.name, c.help, c.value)
+		if err != nil {
+			return
+		}
+	}
+
+	err = reg.RegisterGauge("logmanager_current_file_size_bytes", "Size of the current log file.", func() float64 { return float64(lm.Stats().CurrentFileSize) })
+	if err != nil {
+		return
+	}
+	return reg.RegisterGauge("logmanager_write_rate_bytes", "Bytes written per second, averaged over the rate window.", func() float64 { return lm.Stats().WriteRate })
+}
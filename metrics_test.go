@@ -0,0 +1,205 @@
+package logmanager
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeRegisterer map[string]func() float64
+
+func (r fakeRegisterer) RegisterCounter(name, help string, value func() float64) error {
+	r[name] = value
+	return nil
+}
+
+func (r fakeRegisterer) RegisterGauge(name, help string, value func() float64) error {
+	r[name] = value
+	return nil
+}
+
+func TestStats(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+
+	lm.Write([]byte("test"))
+	lm.Rotate()
+	lm.Write([]byte("test1"))
+
+	stats := lm.Stats()
+	if stats.Rotations != 2 {
+		t.Errorf("Expected 2 rotations, got %d", stats.Rotations)
+	}
+	if stats.BytesWritten != 9 {
+		t.Errorf("Expected 9 bytes written, got %d", stats.BytesWritten)
+	}
+	if stats.CurrentFileSize != 5 {
+		t.Errorf("Expected current file size of 5, got %d", stats.CurrentFileSize)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestRegisterCollectors(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+
+	reg := fakeRegisterer{}
+	err := lm.RegisterCollectors(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm.Write([]byte("test"))
+
+	for name, want := range map[string]float64{
+		"logmanager_rotations_total":          1,
+		"logmanager_bytes_written_total":      4,
+		"logmanager_compression_errors_total": 0,
+		"logmanager_current_file_size_bytes":  4,
+	} {
+		value, ok := reg[name]
+		if !ok {
+			t.Errorf("%s was not registered", name)
+			continue
+		}
+		if got := value(); got != want {
+			t.Errorf("%s is %v, expected %v", name, got, want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestSlowRotation(t *testing.T) {
+	out := new(bytes.Buffer)
+	lm := setup(LogManagerOptions{
+		GZIP:                  true,
+		SlowRotationThreshold: time.Millisecond * 10,
+		Logger:                log.New(out, "", 0),
+	})
+
+	// Use a deliberately slow compressor
+	lm.compressor = func(ctx context.Context, filename, dest string) error {
+		time.Sleep(time.Millisecond * 50)
+		return lm.compress(ctx, filename, dest)
+	}
+
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := lm.Stats()
+	if stats.LastRotationDuration < time.Millisecond*50 || stats.MaxRotationDuration < stats.LastRotationDuration {
+		t.Errorf("Rotation durations were not recorded: %+v", stats)
+	}
+	if !strings.Contains(out.String(), "rotation took") {
+		t.Error("Slow rotation did not log a warning")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestWriteRate(t *testing.T) {
+	now := time.Date(2022, 5, 17, 12, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		RateWindow: time.Second * 10,
+		Now:        func() time.Time { return now },
+	})
+
+	// 100 bytes every 100ms, for long enough to warm up the average, is 1000 bytes a second
+	line := []byte(strings.Repeat("a", 99) + "\n")
+	for i := 0; i < 600; i++ {
+		now = now.Add(time.Millisecond * 100)
+		lm.Write(line)
+	}
+	if rate := lm.Stats().WriteRate; rate < 950 || rate > 1050 {
+		t.Errorf("Expected a write rate of about 1000, got %v", rate)
+	}
+
+	// Going quiet for a window should decay it by a factor of e
+	now = now.Add(time.Second * 10)
+	if rate := lm.Stats().WriteRate; rate < 950/2.718 || rate > 1050/2.718 {
+		t.Errorf("Expected a write rate of about 368, got %v", rate)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestBurstRate(t *testing.T) {
+	now := time.Date(2022, 5, 17, 12, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		RateWindow: time.Second * 10,
+		BurstRate:  2000,
+		Now:        func() time.Time { return now },
+	})
+	before := lm.Stats().Rotations
+
+	write := func(n int, every time.Duration) {
+		line := []byte(strings.Repeat("a", 99) + "\n")
+		for i := 0; i < n; i++ {
+			now = now.Add(every)
+			lm.Write(line)
+		}
+	}
+
+	// A steady 1000 bytes a second stays under the threshold
+	write(600, time.Millisecond*100)
+	if got := lm.Stats().Rotations - before; got != 0 {
+		t.Fatalf("Expected no rotations below the burst rate, got %d", got)
+	}
+
+	// Going up to 10000 bytes a second should rotate once, not on every write
+	write(600, time.Millisecond*10)
+	if got := lm.Stats().Rotations - before; got != 1 {
+		t.Fatalf("Expected 1 rotation for the burst, got %d", got)
+	}
+
+	// Once it's calmed down, the next burst gets its own log too
+	write(600, time.Millisecond*100)
+	write(600, time.Millisecond*10)
+	if got := lm.Stats().Rotations - before; got != 2 {
+		t.Errorf("Expected 2 rotations for two bursts, got %d", got)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestBurstRateRotateFailed(t *testing.T) {
+	now := time.Date(2022, 5, 17, 12, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		RateWindow:   time.Second * 10,
+		BurstRate:    2000,
+		MinFreeBytes: 1,
+		Now:          func() time.Time { return now },
+	})
+	fs := &mockFS{reportFree: true}
+	lm.fs = fs
+	before := lm.Stats().Rotations
+
+	line := []byte(strings.Repeat("a", 99) + "\n")
+	write := func(n int) {
+		for i := 0; i < n; i++ {
+			now = now.Add(time.Millisecond * 10)
+			lm.Write(line)
+		}
+	}
+
+	// The burst can't get a log of its own while the disk is full
+	write(600)
+	if got := lm.Stats().Rotations - before; got != 0 {
+		t.Fatalf("Expected no rotations without room for a new log, got %d", got)
+	}
+
+	// So it should get one as soon as there's room, rather than waiting for the next burst
+	fs.free = 1 << 30
+	write(10)
+	if got := lm.Stats().Rotations - before; got != 1 {
+		t.Errorf("Expected 1 rotation once there was room, got %d", got)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
@@ -0,0 +1,165 @@
+package logmanager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// MigrateDir moves logging over to newDir without restarting, taking the current log, latest, and the PID and sequence
+// files along with it. Old logs are left where they are.
+func (lm *LogManager) MigrateDir(newDir string) (err error) {
+	lm.Lock()
+	defer lm.Unlock()
+
+	// Create the log LazyCreate put off, so there's a file to move
+	err = lm.createPending()
+	if err != nil {
+		return
+	}
+	if lm.currentFile == nil || lm.closed || lm.shuttingDown {
+		return os.ErrClosed
+	}
+	if lm.options.FIFO {
+		return errors.New("unable to migrate a FIFO")
+	}
+	if lm.streaming() {
+		return errors.New("unable to migrate a compressed stream")
+	}
+	oldDir := lm.options.Dir
+	if filepath.Clean(newDir) == filepath.Clean(oldDir) {
+		return nil
+	}
+
+	// Work out where the current log goes, keeping it in the same subdirectory (if FilenameFormat has any)
+	rel, err := filepath.Rel(oldDir, lm.currentFile.Name())
+	if err != nil {
+		return fmt.Errorf("unable to find the log file in %s: %w", oldDir, err)
+	}
+	name := lm.currentFile.Name()
+	dest := filepath.Join(newDir, rel)
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create log directory: %w", err)
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// The file has to be closed first, since Windows won't move a file that's open
+	err = lm.wake()
+	if err != nil {
+		return
+	}
+	err = lm.currentFile.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close log file: %w", err)
+	}
+	moveErr := lm.moveFile(name, dest)
+	if moveErr != nil {
+		dest = name
+	}
+	reopened, err := lm.fs.OpenFile(dest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		// Put it back, and treat it like an idle file, so the next write tries to reopen it again
+		if moveErr == nil {
+			lm.moveFile(dest, name)
+		}
+		lm.idle = true
+		return fmt.Errorf("unable to reopen log file: %w", err)
+	}
+	lm.currentFile = reopened
+	if moveErr != nil {
+		return fmt.Errorf("unable to move log file: %w", moveErr)
+	}
+
+	// Take latest and the PID file down from the old directory, before we lose track of it
+	if lm.latestFile != nil {
+		lm.latestFile.Close()
+		lm.latestFile = nil
+	}
+	if lm.ownsLatest {
+		os.Remove(filepath.Join(oldDir, "latest"))
+		lm.ownsLatest = false
+	}
+	if lm.options.WritePIDFile {
+		err = lm.removePIDFile()
+		if err != nil {
+			lm.logf("%s", err)
+		}
+	}
+
+	lm.options.Dir = filepath.Clean(newDir)
+	if lm.options.WritePIDFile {
+		err = lm.writePIDFile()
+		if err != nil {
+			return
+		}
+	}
+	if lm.options.SequenceNumbers {
+		err = lm.saveSequence()
+		if err != nil {
+			return
+		}
+	}
+	if g := lm.options.SharedRetention; g != nil {
+		g.update(lm)
+	}
+	lm.rotateFollowers()
+
+	return lm.setSymlink()
+}
+
+// moveFile is a helper function that moves the file at from to to, copying it (then removing it) if it can't be renamed,
+// e.g. across devices. The lock must already be held.
+func (lm *LogManager) moveFile(from, to string) error {
+	renameErr := os.Rename(from, to)
+	if renameErr == nil {
+		return nil
+	}
+
+	err := lm.copyAcross(from, to)
+	if err != nil {
+		return renameErr
+	}
+	err = os.Remove(from)
+	if err != nil {
+		os.Remove(to)
+		return err
+	}
+	return nil
+}
+
+// copyAcross is a helper function that copies the file at from to a new file at to, with the same permissions.
+// The lock must already be held.
+func (lm *LogManager) copyAcross(from, to string) (err error) {
+	src, err := os.Open(from)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return
+	}
+
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(dst, src)
+	if err == nil && lm.options.SyncDir {
+		err = lm.fs.Sync(dst)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(to)
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package logmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateDir(t *testing.T) {
+	lm := setup(LogManagerOptions{LatestDotLog: true})
+	oldDir := lm.options.Dir
+	newDir := filepath.Join(t.TempDir(), "new")
+
+	lm.Write([]byte("before\n"))
+	old := lm.currentFile.Name()
+	err := lm.MigrateDir(newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm.Write([]byte("after\n"))
+
+	// The current log should've moved, and carried on being written to
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("%s was left in the old directory", old)
+	}
+	if _, err := os.Lstat(filepath.Join(oldDir, "latest")); !os.IsNotExist(err) {
+		t.Error("latest was left in the old directory")
+	}
+	moved := filepath.Join(newDir, filepath.Base(old))
+	if lm.CurrentFilename() != moved {
+		t.Errorf("Current log is %s, expected %s", lm.CurrentFilename(), moved)
+	}
+	b, err := os.ReadFile(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "before\nafter\n" {
+		t.Errorf("Migrated log contains %q", b)
+	}
+	if target, err := os.Readlink(filepath.Join(newDir, "latest")); err != nil || target != moved {
+		t.Errorf("latest in the new directory points to %q (%v)", target, err)
+	}
+
+	// Rotations should happen in the new directory
+	err = lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(lm.CurrentFilename()) != newDir {
+		t.Errorf("Rotated to %s, outside of the new directory", lm.CurrentFilename())
+	}
+
+	os.RemoveAll(oldDir)
+}
+
+func TestMigrateDirUnclean(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+	oldDir := lm.options.Dir
+	newDir := filepath.Join(t.TempDir(), "new")
+
+	// Where logging moved to should be kept tidied up, so it can be compared against later
+	err := lm.MigrateDir(newDir + string(filepath.Separator) + "." + string(filepath.Separator))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir := lm.Options().Dir; dir != newDir {
+		t.Errorf("Log directory is %q, expected %q", dir, newDir)
+	}
+	err = lm.MigrateDir(newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(lm.CurrentFilename()) != newDir {
+		t.Errorf("Current log is %s, outside of %s", lm.CurrentFilename(), newDir)
+	}
+
+	lm.Close()
+	os.RemoveAll(oldDir)
+}
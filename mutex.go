@@ -0,0 +1,39 @@
+package logmanager
+
+import "time"
+
+// mutex is a channel-based mutex. Unlike sync.Mutex, it can give up on acquiring the lock after a timeout.
+type mutex struct {
+	ch chan struct{}
+}
+
+func newMutex() mutex {
+	return mutex{ch: make(chan struct{}, 1)}
+}
+
+// Lock locks m, blocking until it's available
+func (m mutex) Lock() {
+	m.ch <- struct{}{}
+}
+
+// Unlock unlocks m. It's a run-time error if m is not locked.
+func (m mutex) Unlock() {
+	select {
+	case <-m.ch:
+	default:
+		panic("logmanager: unlock of unlocked mutex")
+	}
+}
+
+// lockTimeout tries to lock m, giving up after d. It reports whether the lock was acquired.
+func (m mutex) lockTimeout(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case m.ch <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
@@ -0,0 +1,88 @@
+package logmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Partition nests rotated logs in date subdirectories of Dir, for long-term retention
+type Partition int
+
+const (
+	// PartitionNone leaves rotated logs where they are (default)
+	PartitionNone Partition = iota
+	// PartitionDay moves rotated logs into YYYY/MM/DD
+	PartitionDay
+	// PartitionMonth moves rotated logs into YYYY/MM
+	PartitionMonth
+)
+
+// layout returns the time layout of the partition's subdirectory
+func (p Partition) layout() string {
+	switch p {
+	case PartitionDay:
+		return filepath.Join("2006", "01", "02")
+	case PartitionMonth:
+		return filepath.Join("2006", "01")
+	}
+	return ""
+}
+
+// partition is a helper function that moves the rotated log closedFn into the partition for started, the time it was
+// started at, and returns its new name. Existing files are never replaced.
+func (lm *LogManager) partition(closedFn string, started time.Time) (string, error) {
+	rel, err := filepath.Rel(lm.options.Dir, closedFn)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(lm.options.Dir, started.Format(lm.options.PartitionBy.layout()), rel)
+
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return "", fmt.Errorf("unable to create partition: %w", err)
+	}
+
+	// Check if there's already a log by that name in the partition
+	if _, err := os.Lstat(dest); err == nil {
+		return "", fmt.Errorf("%s already exists", dest)
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	err = os.Rename(closedFn, dest)
+	if err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// isPartition is a helper function that checks if path is the top of a partition (a year directory directly in Dir)
+func (lm *LogManager) isPartition(path string) bool {
+	if lm.options.PartitionBy == PartitionNone || filepath.Dir(path) != filepath.Clean(lm.options.Dir) {
+		return false
+	}
+	name := filepath.Base(path)
+	_, err := strconv.Atoi(name)
+	return len(name) == 4 && err == nil
+}
+
+// removeEmptyPartitions is a helper function that removes dir, and the directories above it, until one isn't empty.
+// It never goes above Dir or ArchiveDir.
+func (lm *LogManager) removeEmptyPartitions(dir string) {
+	if lm.options.PartitionBy == PartitionNone {
+		return
+	}
+	for {
+		dir = filepath.Clean(dir)
+		if dir == filepath.Clean(lm.options.Dir) || dir == filepath.Clean(lm.options.ArchiveDir) || dir == filepath.Dir(dir) {
+			return
+		}
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
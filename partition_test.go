@@ -0,0 +1,92 @@
+package logmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPartitionBy(t *testing.T) {
+	for _, test := range []struct {
+		partition Partition
+		gzip      bool
+		want      []string
+	}{
+		{PartitionDay, false, []string{"2022/05/17/0.log", "2022/05/18/1.log"}},
+		{PartitionMonth, true, []string{"2022/05/0.tar.gz", "2022/05/1.tar.gz"}},
+	} {
+		now := time.Date(2022, 5, 17, 12, 0, 0, 0, time.UTC)
+		lm := setup(LogManagerOptions{
+			FilenameFormat: "{{ .Iteration }}.log",
+			PartitionBy:    test.partition,
+			GZIP:           test.gzip,
+			Now:            func() time.Time { return now },
+		})
+
+		// Each file goes in the partition for when it was started, not when it was rotated
+		for i := 0; i < 2; i++ {
+			lm.Write([]byte("line\n"))
+			now = now.Add(24 * time.Hour)
+			err := lm.Rotate()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, name := range test.want {
+			if _, err := os.Stat(filepath.Join(lm.options.Dir, filepath.FromSlash(name))); err != nil {
+				t.Errorf("Rotated log wasn't partitioned: %s", err)
+			}
+		}
+		if filepath.Dir(lm.CurrentFilename()) != lm.options.Dir {
+			t.Errorf("Current log %s was partitioned", lm.CurrentFilename())
+		}
+
+		os.RemoveAll(lm.options.Dir)
+	}
+}
+
+func TestPartitionRetention(t *testing.T) {
+	now := time.Date(2022, 5, 17, 12, 0, 0, 0, time.UTC)
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "{{ .Iteration }}.log",
+		PartitionBy:    PartitionDay,
+		MaxBackups:     1,
+		Now:            func() time.Time { return now },
+	})
+
+	for i := 0; i < 3; i++ {
+		lm.Write([]byte("line\n"))
+		now = now.Add(24 * time.Hour)
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the newest backup is left, and the partitions it emptied are gone
+	found, err := lm.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].path != filepath.Join(lm.options.Dir, "2022", "05", "19", "2.log") {
+		t.Errorf("Found backups %v, expected only 2022/05/19/2.log", found)
+	}
+	for _, day := range []string{"17", "18"} {
+		if _, err := os.Stat(filepath.Join(lm.options.Dir, "2022", "05", day)); !os.IsNotExist(err) {
+			t.Errorf("Empty partition 2022/05/%s wasn't removed", day)
+		}
+	}
+
+	// Restarting shouldn't pick up a partitioned log as the current one
+	current := lm.CurrentFilename()
+	lm.Close()
+	lm = NewLogManager(lm.options)
+	if lm.CurrentFilename() != current {
+		t.Errorf("Restarted with %s, expected %s", lm.CurrentFilename(), current)
+	}
+
+	lm.Close()
+	os.RemoveAll(lm.options.Dir)
+}
@@ -0,0 +1,55 @@
+package logmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pidFileName is the name of the file in the log directory that records which process is writing to it
+const pidFileName = ".logmanager.pid"
+
+// ErrDirInUse is returned when WritePIDFile and PIDFileStrict are set, and another live process already owns the log directory
+var ErrDirInUse = errors.New("log directory is in use by another process")
+
+// writePIDFile is a helper function that records our PID in the log directory. A PID file left behind by a process that's
+// no longer running is replaced, but one belonging to a live process is either reported or refused, depending on PIDFileStrict.
+func (lm *LogManager) writePIDFile() error {
+	path := filepath.Join(lm.options.Dir, pidFileName)
+
+	// Check if someone else has already claimed the directory
+	if b, err := os.ReadFile(path); err == nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err == nil && pid != os.Getpid() && processAlive(pid) {
+			if lm.options.PIDFileStrict {
+				return fmt.Errorf("%w (pid %d)", ErrDirInUse, pid)
+			}
+			lm.logf("log directory %s is already in use by process %d", lm.options.Dir, pid)
+		}
+	}
+
+	err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write pid file: %w", err)
+	}
+	return nil
+}
+
+// removePIDFile is a helper function that removes our PID file, unless another process has taken it over since
+func (lm *LogManager) removePIDFile() error {
+	path := filepath.Join(lm.options.Dir, pidFileName)
+
+	b, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(b)) != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		return fmt.Errorf("unable to remove pid file: %w", err)
+	}
+	return nil
+}
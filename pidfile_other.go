@@ -0,0 +1,20 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package logmanager
+
+import "os"
+
+// processAlive checks if the process with the given PID is still running. On Windows, finding the process fails once
+// it's gone. Elsewhere, finding it always succeeds, so processes are assumed to be alive.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
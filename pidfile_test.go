@@ -0,0 +1,112 @@
+package logmanager
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pidDir is a helper function that creates a log directory, with a PID file claimed by pid
+func pidDir(t *testing.T, pid int) string {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, pidFileName), []byte(strconv.Itoa(pid)+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPIDFile(t *testing.T) {
+	lm := setup(LogManagerOptions{WritePIDFile: true})
+	pidFile := filepath.Join(lm.options.Dir, pidFileName)
+
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(b)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("PID file contains %q, expected %d", b, os.Getpid())
+	}
+
+	err = lm.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(pidFile)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Error("PID file was not removed on close")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestPIDFileStale(t *testing.T) {
+	// Nothing should be running with this PID
+	dir := pidDir(t, 999999999)
+
+	lm := NewLogManager(LogManagerOptions{Dir: dir, WritePIDFile: true, PIDFileStrict: true})
+	b, err := os.ReadFile(filepath.Join(dir, pidFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(b)) != strconv.Itoa(os.Getpid()) {
+		t.Error("Stale PID file was not replaced")
+	}
+
+	lm.Close()
+	os.RemoveAll(dir)
+}
+
+func TestPIDFileLive(t *testing.T) {
+	// Our parent is still running
+	dir := pidDir(t, os.Getppid())
+
+	// By default, we take over but warn about it
+	buf := new(bytes.Buffer)
+	lm := NewLogManager(LogManagerOptions{Dir: dir, WritePIDFile: true, Logger: log.New(buf, "", 0)})
+	if !strings.Contains(buf.String(), "already in use") {
+		t.Errorf("Didn't warn about the live PID file, logged %q", buf.String())
+	}
+	lm.Close()
+	os.RemoveAll(dir)
+
+	// In strict mode, we refuse
+	dir = pidDir(t, os.Getppid())
+	func() {
+		defer func() {
+			err, _ := recover().(error)
+			if !errors.Is(err, ErrDirInUse) {
+				t.Errorf("Expected ErrDirInUse, got %v", err)
+			}
+		}()
+		NewLogManager(LogManagerOptions{Dir: dir, WritePIDFile: true, PIDFileStrict: true})
+	}()
+	os.RemoveAll(dir)
+}
+
+func TestPIDFileOpenFailure(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Failing to open after claiming the directory shouldn't leave our PID behind
+	lm := New(LogManagerOptions{Dir: dir, WritePIDFile: true, AdoptFile: "missing.log"})
+	err = lm.Open()
+	if err == nil {
+		t.Fatal("Adopting a missing file didn't fail")
+	}
+	_, err = os.Stat(filepath.Join(dir, pidFileName))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Error("PID file was left behind after Open failed")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package logmanager
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive checks if the process with the given PID is still running, by sending it the null signal
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	// EPERM means it exists, it just isn't ours
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,88 @@
+package logmanager
+
+import (
+	"errors"
+	"sync"
+)
+
+// QueuePolicy controls what Write does when the AsyncQueue is full
+type QueuePolicy int
+
+const (
+	// QueueBlock waits for room in the queue (default)
+	QueueBlock QueuePolicy = iota
+	// QueueDrop gives up straight away with ErrQueueFull, passing the write to OnDrop
+	QueueDrop
+)
+
+// ErrQueueFull is returned by Write when the AsyncQueue is full, and QueueFullPolicy is QueueDrop
+var ErrQueueFull = errors.New("write queue is full")
+
+// writeQueue hands writes off to a single background goroutine, which writes them in order
+type writeQueue struct {
+	mu     sync.RWMutex
+	writes chan [][]byte // Nil unless AsyncQueue is set
+	drop   bool
+	closed bool
+	done   chan struct{} // Closed once everything queued has been written
+}
+
+// startQueue is a helper function that starts writing in the background through a queue of the given size
+func (lm *LogManager) startQueue(size int, policy QueuePolicy) {
+	lm.queue.mu.Lock()
+	defer lm.queue.mu.Unlock()
+
+	lm.queue.writes = make(chan [][]byte, size)
+	lm.queue.drop = policy == QueueDrop
+	lm.queue.done = make(chan struct{})
+
+	go func() {
+		defer close(lm.queue.done)
+		for lines := range lm.queue.writes {
+			lm.writeAll(lines)
+		}
+	}()
+}
+
+// enqueue is a helper function that queues lines to be written in the background. If there's no queue (or it's been
+// stopped), it returns false, and they should be written straight away instead.
+func (lm *LogManager) enqueue(lines [][]byte) (queued bool, err error) {
+	lm.queue.mu.RLock()
+	defer lm.queue.mu.RUnlock()
+
+	if lm.queue.writes == nil || lm.queue.closed {
+		return false, nil
+	}
+
+	// The caller is free to reuse its buffers once we've returned
+	batch := make([][]byte, len(lines))
+	for i, line := range lines {
+		batch[i] = append([]byte(nil), line...)
+	}
+
+	if lm.queue.drop {
+		select {
+		case lm.queue.writes <- batch:
+			return true, nil
+		default:
+			return true, ErrQueueFull
+		}
+	}
+	lm.queue.writes <- batch
+	return true, nil
+}
+
+// stopQueue is a helper function that stops accepting writes into the queue, and waits for what's already in it to be
+// written. The lock must not be held, since the background writes need it.
+func (lm *LogManager) stopQueue() {
+	lm.queue.mu.Lock()
+	if lm.queue.writes == nil || lm.queue.closed {
+		lm.queue.mu.Unlock()
+		return
+	}
+	lm.queue.closed = true
+	close(lm.queue.writes)
+	lm.queue.mu.Unlock()
+
+	<-lm.queue.done
+}
@@ -0,0 +1,84 @@
+package logmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAsyncQueue(t *testing.T) {
+	lm := setup(LogManagerOptions{AsyncQueue: 16})
+	filename := lm.CurrentFilename()
+
+	var want strings.Builder
+	line := make([]byte, 0, 16)
+	for i := 0; i < 1000; i++ {
+		// Reuse the buffer, like the log package does
+		line = append(line[:0], fmt.Sprintf("line %d\n", i)...)
+		want.Write(line)
+		n, err := lm.Write(line)
+		if err != nil || n != len(line) {
+			t.Fatalf("Write returned %d, %v", n, err)
+		}
+	}
+	lm.WriteAll([][]byte{[]byte("batch 1\n"), []byte("batch 2\n")})
+	want.WriteString("batch 1\nbatch 2\n")
+
+	// Everything should be written, in order, by the time Close returns
+	err := lm.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want.String() {
+		t.Errorf("Log contains %d bytes that don't match the %d written", len(b), want.Len())
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestAsyncQueueDrop(t *testing.T) {
+	var dropped []string
+	lm := setup(LogManagerOptions{
+		AsyncQueue:      2,
+		QueueFullPolicy: QueueDrop,
+		OnDrop:          func(p []byte, err error) { dropped = append(dropped, string(p)) },
+	})
+	filename := lm.CurrentFilename()
+
+	// Hold up the background writes, so the queue fills up
+	lm.Lock()
+	var accepted strings.Builder
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		_, err = lm.Write([]byte(line))
+		if err == nil {
+			accepted.WriteString(line)
+		}
+	}
+	lm.Unlock()
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Write returned %v once the queue was full, expected ErrQueueFull", err)
+	}
+	if len(dropped) != 1 {
+		t.Errorf("Dropped %q, expected the write that didn't fit", dropped)
+	}
+
+	// What did fit should still be written
+	lm.Close()
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != accepted.String() {
+		t.Errorf("Log contains %q, expected %q", b, accepted.String())
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
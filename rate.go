@@ -0,0 +1,56 @@
+package logmanager
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRateWindow is the window the write rate is averaged over, when RateWindow isn't set
+const DefaultRateWindow = time.Minute
+
+// writeRate is a helper function that returns the average write rate at t, in bytes per second, decaying what was
+// last recorded for as long as there's been nothing to record since
+func (lm *LogManager) writeRate(t time.Time) float64 {
+	rate := math.Float64frombits(atomic.LoadUint64(&lm.stats.writeRate))
+	updated := atomic.LoadInt64(&lm.stats.rateUpdated)
+	window := atomic.LoadInt64(&lm.stats.rateWindow)
+	if updated == 0 || window <= 0 {
+		return rate
+	}
+
+	if elapsed := t.UnixNano() - updated; elapsed > 0 {
+		rate *= math.Exp(-float64(elapsed) / float64(window))
+	}
+	return rate
+}
+
+// recordWrite is a helper function that adds a write of n bytes to the exponentially weighted write rate.
+// The lock must already be held.
+func (lm *LogManager) recordWrite(n int) {
+	now := lm.options.Now()
+	window := atomic.LoadInt64(&lm.stats.rateWindow)
+	rate := lm.writeRate(now) + float64(n)/time.Duration(window).Seconds()
+
+	atomic.StoreUint64(&lm.stats.writeRate, math.Float64bits(rate))
+	atomic.StoreInt64(&lm.stats.rateUpdated, now.UnixNano())
+
+	// A burst is over once the rate's dropped back down, so the next one gets a log of its own too
+	if lm.bursting && rate <= lm.options.BurstRate {
+		lm.bursting = false
+	}
+}
+
+// burstStarted is a helper function that checks if the write rate has just gone above BurstRate, and the burst doesn't
+// have a log of its own yet. The lock must already be held.
+func (lm *LogManager) burstStarted() bool {
+	return !lm.bursting && lm.writeRate(lm.options.Now()) > lm.options.BurstRate
+}
+
+// noteBurst is a helper function that marks a burst as having its own log, if the rotation that's just been done came
+// during one. Until then (e.g. if rotating failed), the burst keeps asking for one. The lock must already be held.
+func (lm *LogManager) noteBurst() {
+	if lm.options.BurstRate > 0 && lm.writeRate(lm.options.Now()) > lm.options.BurstRate {
+		lm.bursting = true
+	}
+}
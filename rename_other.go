@@ -0,0 +1,10 @@
+//go:build !windows
+
+package logmanager
+
+import "os"
+
+// replaceFile renames from to to, atomically replacing to if it already exists
+func replaceFile(from, to string) error {
+	return os.Rename(from, to)
+}
@@ -0,0 +1,61 @@
+package logmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	from, to := filepath.Join(dir, "from"), filepath.Join(dir, "to")
+	os.WriteFile(from, []byte("new"), 0644)
+
+	// A read-only destination can't be replaced in place on Windows
+	os.WriteFile(to, []byte("old"), 0444)
+
+	err = replaceFile(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "new" {
+		t.Errorf("Destination contains %q, expected %q", b, "new")
+	}
+	if _, err := os.Stat(from); !os.IsNotExist(err) {
+		t.Error("Source still exists")
+	}
+}
+
+func TestCompressOverExistingArchive(t *testing.T) {
+	lm := setup(LogManagerOptions{GZIP: true})
+
+	// Something's already where the archive is going
+	old := lm.currentFile.Name()
+	dest := archiveName(old, CompressTarGz)
+	os.WriteFile(dest, []byte("stale"), 0644)
+
+	lm.Write([]byte("test"))
+	err := lm.compress(context.Background(), old, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) == "stale" {
+		t.Error("Existing archive was not replaced")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
@@ -0,0 +1,24 @@
+package logmanager
+
+import (
+	"errors"
+	"os"
+)
+
+// replaceFile renames from to to, replacing to if it already exists, by removing it first if os.Rename can't replace it
+// in place (e.g. it's read-only). That fallback isn't atomic.
+func replaceFile(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := os.Lstat(to); statErr != nil {
+		return err
+	}
+
+	rmErr := os.Remove(to)
+	if rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+		return err
+	}
+	return os.Rename(from, to)
+}
@@ -0,0 +1,76 @@
+package logmanager
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// repairArchives is a helper function that removes truncated or corrupt archives a crash could have left behind, and
+// compresses them again from their originals, if they're still there. The lock must already be held.
+func (lm *LogManager) repairArchives() {
+	found, err := lm.backups()
+	if err != nil {
+		lm.logf("unable to find archives to check: %s", err)
+		return
+	}
+
+	// Work out which archive each of the uncompressed logs would've been compressed into
+	originals := map[string]string{}
+	var newest string
+	for _, b := range found {
+		if isArchive(b.path) {
+			newest = b.path
+			continue
+		}
+		originals[lm.archivePath(b.path)] = b.path
+	}
+
+	for _, b := range found {
+		original, ok := originals[b.path]
+		if !isArchive(b.path) || (!ok && b.path != newest) {
+			continue
+		}
+
+		err := verifyArchive(b.path)
+		if err == nil {
+			continue
+		}
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			lm.logf("unable to check archive %s: %s", b.path, err)
+			continue
+		}
+
+		lm.logf("removing corrupt archive %s: %s", b.path, err)
+		err = os.Remove(b.path)
+		if err != nil {
+			lm.logf("unable to remove corrupt archive: %s", err)
+			continue
+		}
+		err = removeArchiveMeta(b.path)
+		if err != nil {
+			lm.logf("%s", err)
+		}
+
+		if ok {
+			err = lm.compressOld(original, b.path, true)
+			if err != nil {
+				lm.logf("unable to compress %s again: %s", original, err)
+			}
+		}
+	}
+}
+
+// verifyArchive is a helper function that reads the whole of the archive at path, returning an error if it's truncated
+// or corrupt. Errors opening it are returned as *os.PathError.
+func verifyArchive(path string) error {
+	r, err := openLog(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
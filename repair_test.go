@@ -0,0 +1,59 @@
+package logmanager
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepairArchivesOnStart(t *testing.T) {
+	lm := setup(LogManagerOptions{GZIP: true})
+	content := strings.Repeat("compressed line\n", 100)
+	lm.Write([]byte(content))
+	original := lm.CurrentFilename()
+	err := lm.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm.Close()
+
+	// Pretend we crashed partway through compressing it, leaving a truncated archive next to the original log
+	archive := lm.archivePath(original)
+	b, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(archive, b[:len(b)/2], 0644)
+	os.WriteFile(original, []byte(content), 0644)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(original, past, past)
+	if verifyArchive(archive) == nil {
+		t.Fatal("Truncated archive passed verification")
+	}
+
+	options := lm.options
+	options.RepairArchivesOnStart = true
+	lm = NewLogManager(options)
+	defer lm.Close()
+
+	// The archive should've been rebuilt from the original
+	r, err := openLog(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Archive wasn't repaired: %s", err)
+	}
+	if string(b) != content {
+		t.Errorf("Repaired archive contains %d bytes, expected %d", len(b), len(content))
+	}
+	if _, err := os.Stat(original); !os.IsNotExist(err) {
+		t.Error("Original log wasn't removed once it was compressed again")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
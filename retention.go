@@ -0,0 +1,369 @@
+package logmanager
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backup is an old log (compressed or not) found in the log or archive directory
+type backup struct {
+	path string
+	info os.FileInfo
+}
+
+// backups is a helper function that finds all of the old logs FilenameFormat could have named, oldest first, leaving out
+// the current log and originals that are only waiting to be removed.
+func (lm *LogManager) backups() (found []backup, err error) {
+	skip := map[string]bool{}
+	if lm.currentFile != nil {
+		skip[lm.currentFile.Name()] = true
+	}
+	lm.inFlight.Range(func(path, _ interface{}) bool {
+		skip[path.(string)] = true
+		return true
+	})
+
+	return findBackups(lm.backupDirs(), skip, lm.options.TempSuffix, lm.logNames())
+}
+
+// backupDirs is a helper function that returns the directories old logs are kept in
+func (lm *LogManager) backupDirs() []string {
+	dirs := []string{lm.options.Dir}
+	if lm.options.ArchiveDir != "" && !strings.HasPrefix(lm.options.ArchiveDir, lm.options.Dir+string(filepath.Separator)) {
+		dirs = append(dirs, lm.options.ArchiveDir)
+	}
+	return dirs
+}
+
+// findBackups is a helper function that finds all of the old logs in dirs that names matches (all of them, if it's
+// nil), oldest first, skipping the ones in skip
+func findBackups(dirs []string, skip map[string]bool, tempSuffix string, names *regexp.Regexp) (found []backup, err error) {
+	for _, dir := range dirs {
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() || isReserved(info.Name()) || isTemp(info.Name(), tempSuffix) || skip[path] {
+				return nil
+			}
+			if names != nil && !names.MatchString(filepath.ToSlash(path)) {
+				return nil
+			}
+
+			found = append(found, backup{path, info})
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].info.ModTime().Before(found[j].info.ModTime()) })
+	return found, nil
+}
+
+// enforceRetention is a helper function that deletes the oldest backups until MaxBackups, MaxFiles, and MaxTotalLines
+// are satisfied. The lock must already be held, and the new log file must already be open.
+func (lm *LogManager) enforceRetention() (err error) {
+	if lm.options.MaxBackups <= 0 && lm.options.MaxFiles <= 0 && lm.options.MaxTotalLines <= 0 {
+		return
+	}
+
+	found, err := lm.backups()
+	if err != nil {
+		return
+	}
+
+	// MaxFiles includes the current log file, MaxBackups doesn't
+	keep := len(found)
+	if lm.options.MaxBackups > 0 && keep > lm.options.MaxBackups {
+		keep = lm.options.MaxBackups
+	}
+	if lm.options.MaxFiles > 0 && keep > lm.options.MaxFiles-1 {
+		keep = lm.options.MaxFiles - 1
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	if lm.options.MaxTotalLines > 0 {
+		keep, err = lm.keepLines(found, keep)
+		if err != nil {
+			return
+		}
+	}
+
+	return lm.removeBackups(found[:len(found)-keep])
+}
+
+// keepLines is a helper function that works out how many of the newest of found can be kept (up to keep) without
+// going over MaxTotalLines, counting the current log too. The lock must already be held.
+func (lm *LogManager) keepLines(found []backup, keep int) (int, error) {
+	var total int64
+	if lm.currentFile != nil {
+		lines, err := countLines(lm.currentFile.Name())
+		if err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("unable to count lines in %s: %w", lm.currentFile.Name(), err)
+		}
+		total += lines
+	}
+
+	for i := 0; i < keep; i++ {
+		b := found[len(found)-1-i]
+		lines, err := countLines(b.path)
+		if err != nil {
+			return 0, fmt.Errorf("unable to count lines in %s: %w", b.path, err)
+		}
+		total += lines
+		if total > lm.options.MaxTotalLines {
+			return i, nil
+		}
+	}
+	return keep, nil
+}
+
+// countLines is a helper function that counts the lines in a log, decompressing it as it goes if it's an archive.
+// A last line without a newline still counts.
+func countLines(path string) (lines int64, err error) {
+	r, err := openLog(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	buf := make([]byte, 32*1024)
+	var last byte = '\n'
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if last != '\n' {
+		lines++
+	}
+	return lines, nil
+}
+
+// enforceSampling is a helper function that thins out backups older than KeepAllFor to the first of each
+// KeepFirstPerPeriod. The lock must already be held, and the new log file must already be open.
+func (lm *LogManager) enforceSampling() (err error) {
+	if lm.options.KeepFirstPerPeriod == PeriodNone {
+		return
+	}
+
+	found, err := lm.backups()
+	if err != nil {
+		return
+	}
+
+	type dated struct {
+		backup
+		time      time.Time
+		iteration uint
+	}
+	pattern, _ := compileFilenamePattern(lm.templater)
+	var old []dated
+	cutoff := lm.options.Now().Add(-lm.options.KeepAllFor)
+	for _, b := range found {
+		d := dated{backup: b, time: b.info.ModTime()}
+		if pattern != nil {
+			if t, iteration, ok := pattern.parse(b.path); ok {
+				d.time, d.iteration = t, iteration
+			}
+		}
+		if d.time.Before(cutoff) {
+			old = append(old, d)
+		}
+	}
+
+	// Keep the earliest in each period
+	sort.SliceStable(old, func(i, j int) bool {
+		if !old[i].time.Equal(old[j].time) {
+			return old[i].time.Before(old[j].time)
+		}
+		return old[i].iteration < old[j].iteration
+	})
+	var remove []backup
+	kept := map[time.Time]bool{}
+	for _, d := range old {
+		period := lm.options.KeepFirstPerPeriod.start(d.time)
+		if kept[period] {
+			remove = append(remove, d.backup)
+			continue
+		}
+		kept[period] = true
+	}
+
+	return lm.removeBackups(remove)
+}
+
+// removeBackups is a helper function that deletes the given backups, and drops them from the manifest
+func (lm *LogManager) removeBackups(remove []backup) (err error) {
+	if len(remove) == 0 {
+		return
+	}
+
+	removed := map[string]bool{}
+	for _, b := range remove {
+		err = os.Remove(b.path)
+		if err != nil && !os.IsNotExist(err) {
+			return
+		}
+		err = removeArchiveMeta(b.path)
+		if err != nil {
+			return
+		}
+		lm.removeEmptyPartitions(filepath.Dir(b.path))
+		removed[b.path] = true
+	}
+
+	if lm.options.WriteManifest {
+		m, err := lm.readManifest()
+		if err != nil {
+			return fmt.Errorf("unable to read manifest: %w", err)
+		}
+
+		rotations := m.Rotations[:0]
+		for _, entry := range m.Rotations {
+			if !removed[filepath.Join(lm.options.Dir, entry.Filename)] {
+				rotations = append(rotations, entry)
+			}
+		}
+		m.Rotations = rotations
+
+		return lm.writeManifest(m)
+	}
+
+	return nil
+}
+
+// RetentionGroup enforces a combined budget on the old logs of several LogManagers that set it as their SharedRetention,
+// whenever any of them rotates. The zero value keeps everything.
+type RetentionGroup struct {
+	MaxTotalSize int64         // Combined size of every member's logs, including the current ones (0 for no limit)
+	MaxBackups   int           // Combined number of old logs (0 for no limit)
+	MaxAge       time.Duration // How long to keep old logs (0 for no limit)
+
+	mu      sync.Mutex
+	members map[*LogManager]groupMember
+}
+
+// groupMember is what a RetentionGroup knows about one of its members, as of its last rotation
+type groupMember struct {
+	dirs       []string
+	current    string
+	tempSuffix string
+	names      *regexp.Regexp
+}
+
+// update is a helper function that records lm's current log, joining it to the group if it isn't already.
+// The member's lock must already be held.
+func (g *RetentionGroup) update(lm *LogManager) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.members == nil {
+		g.members = map[*LogManager]groupMember{}
+	}
+	var current string
+	if lm.currentFile != nil {
+		current = lm.currentFile.Name()
+	}
+	g.members[lm] = groupMember{dirs: lm.backupDirs(), current: current, tempSuffix: lm.options.TempSuffix, names: lm.logNames()}
+}
+
+// leave is a helper function that removes lm from the group
+func (g *RetentionGroup) leave(lm *LogManager) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.members, lm)
+}
+
+// enforce is a helper function that deletes the oldest logs across every member, until the group's budget is satisfied
+func (g *RetentionGroup) enforce(now time.Time) (err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.MaxTotalSize <= 0 && g.MaxBackups <= 0 && g.MaxAge <= 0 {
+		return
+	}
+
+	// Never count the current logs, or originals that are only waiting to be removed, since their archives already count
+	current := map[string]bool{}
+	skip := map[string]bool{}
+	for lm, m := range g.members {
+		current[m.current] = true
+		skip[m.current] = true
+		lm.inFlight.Range(func(path, _ interface{}) bool {
+			skip[path.(string)] = true
+			return true
+		})
+	}
+
+	// Only look for the logs each member names itself, but members might share directories, so only count each one once
+	var found []backup
+	seen := map[string]bool{}
+	for _, m := range g.members {
+		logs, err := findBackups(m.dirs, skip, m.tempSuffix, m.names)
+		if err != nil {
+			return err
+		}
+		for _, b := range logs {
+			if !seen[b.path] {
+				seen[b.path] = true
+				found = append(found, b)
+			}
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].info.ModTime().Before(found[j].info.ModTime()) })
+
+	// The current logs count towards the total size, even though they're never removed
+	var total int64
+	for _, b := range found {
+		total += b.info.Size()
+	}
+	for path := range current {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+
+	// Remove the oldest first, until what's left fits
+	for i, b := range found {
+		tooMany := g.MaxBackups > 0 && len(found)-i > g.MaxBackups
+		tooBig := g.MaxTotalSize > 0 && total > g.MaxTotalSize
+		tooOld := g.MaxAge > 0 && now.Sub(b.info.ModTime()) > g.MaxAge
+		if !tooMany && !tooBig && !tooOld {
+			break
+		}
+
+		err = os.Remove(b.path)
+		if err != nil && !os.IsNotExist(err) {
+			return
+		}
+		err = removeArchiveMeta(b.path)
+		if err != nil {
+			return
+		}
+		total -= b.info.Size()
+	}
+
+	return nil
+}
@@ -0,0 +1,387 @@
+package logmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countLogs is a helper function that counts the logs in the log directory, including the current one
+func countLogs(t *testing.T, lm *LogManager) int {
+	found, err := lm.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(found) + 1
+}
+
+func TestMaxFiles(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		MaxFiles: 3,
+		GZIP:     true,
+	})
+
+	for i := 0; i < 5; i++ {
+		lm.Write([]byte("test"))
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := countLogs(t, lm); n > 3 {
+			t.Errorf("Found %d files, including the current one, expected at most 3", n)
+		}
+	}
+
+	// The current file must survive
+	if _, err := os.Stat(lm.currentFile.Name()); err != nil {
+		t.Error(err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestMaxBackups(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		MaxBackups: 2,
+	})
+
+	for i := 0; i < 5; i++ {
+		lm.Write([]byte{byte('0' + i)})
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the newest backups should be left
+	found, err := lm.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("Found %d backups, expected 2", len(found))
+	}
+	for i, b := range found {
+		content, err := os.ReadFile(b.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := string(rune('3' + i)); string(content) != want {
+			t.Errorf("Backup %s contains %q, expected %q", b.path, content, want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestRetentionSharedDir(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "app_{{ .Iteration }}.log",
+		MaxBackups:     1,
+	})
+	other := NewLogManager(LogManagerOptions{
+		Dir:            lm.options.Dir,
+		FilenameFormat: "error_{{ .Iteration }}.log",
+	})
+	other.Write([]byte("error\n"))
+	other.Rotate()
+	other.Write([]byte("error\n"))
+	notes := filepath.Join(lm.options.Dir, "notes.txt")
+	err := os.WriteFile(notes, []byte("mine"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		lm.Write([]byte("app\n"))
+		err = lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only our own old logs count, not the other manager's, or anything else that's in the directory
+	for _, name := range []string{"error_0.log", "error_1.log", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(lm.options.Dir, name)); err != nil {
+			t.Errorf("%s was removed by another manager's retention", name)
+		}
+	}
+	found, err := lm.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || filepath.Base(found[0].path) != "app_2.log" {
+		t.Errorf("Expected app_2.log to be the only backup, found %v", found)
+	}
+
+	other.Close()
+	lm.Close()
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestMaxTotalLines(t *testing.T) {
+	for _, format := range []CompressionFormat{CompressTarGz, CompressGzip} {
+		lm := setup(LogManagerOptions{
+			MaxTotalLines:     10,
+			GZIP:              true,
+			CompressionFormat: format,
+		})
+
+		// Each log gets i+1 lines, the last without a newline
+		for i := 0; i < 5; i++ {
+			lm.Write([]byte(strings.Repeat("test\n", i) + "test"))
+			err := lm.Rotate()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		lm.Write([]byte("test\ntest\n"))
+		lm.Rotate()
+
+		// 2 + 5 + 4 lines is too many, so only the newest two archives should survive
+		found, err := lm.backups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []int64
+		for _, b := range found {
+			if !isArchive(b.path) {
+				t.Errorf("Found uncompressed backup %s", b.path)
+			}
+			n, err := countLines(b.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, n)
+		}
+		if len(lines) != 2 || lines[0] != 5 || lines[1] != 2 {
+			t.Errorf("Expected archives of 5 and 2 lines to be kept, found %v", lines)
+		}
+
+		os.RemoveAll(lm.options.Dir)
+	}
+}
+
+func TestAsyncCompressRetention(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "{{ .Iteration }}.log",
+		GZIP:           true,
+		AsyncCompress:  true,
+		MaxBackups:     1,
+	})
+
+	// Hold up compressing the first log until we're done rotating
+	release := make(chan struct{})
+	first := lm.CurrentFilename()
+	lm.compressor = func(ctx context.Context, filename, dest string) error {
+		if filename == first {
+			<-release
+		}
+		return lm.compress(ctx, filename, dest)
+	}
+
+	for i := 0; i < 3; i++ {
+		lm.Write([]byte("test"))
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The log that's still being compressed shouldn't be removed before its archive exists
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("Log being compressed was removed by retention: %s", err)
+	}
+
+	close(release)
+	lm.Close()
+	if _, err := os.Stat(lm.archivePath(first)); err != nil {
+		t.Errorf("Log being compressed never made it into an archive: %s", err)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestRetentionManifest(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		MaxBackups:    1,
+		WriteManifest: true,
+	})
+
+	for i := 0; i < 3; i++ {
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Deleted backups should be dropped from the manifest
+	m, err := lm.readManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Rotations) != 1 {
+		t.Errorf("Expected 1 rotation in the manifest, found %d", len(m.Rotations))
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestSharedRetention(t *testing.T) {
+	group := &RetentionGroup{MaxTotalSize: 100}
+	access := setup(LogManagerOptions{
+		FilenameFormat:  "access_{{ .Iteration }}.log",
+		SharedRetention: group,
+	})
+	errorLog := NewLogManager(LogManagerOptions{
+		Dir:             access.options.Dir,
+		FilenameFormat:  "error_{{ .Iteration }}.log",
+		SharedRetention: group,
+	})
+
+	line := []byte(strings.Repeat("x", 29) + "\n")
+	for i := 0; i < 5; i++ {
+		for _, lm := range []*LogManager{access, errorLog} {
+			lm.Write(line)
+			err := lm.Rotate()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Between them, the two managers' logs should fit in the budget
+	var total int64
+	var accessLogs, errorLogs int
+	entries, err := os.ReadDir(access.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Mode().IsRegular() || isReserved(info.Name()) {
+			continue
+		}
+		total += info.Size()
+		if strings.HasPrefix(info.Name(), "access_") {
+			accessLogs++
+		} else {
+			errorLogs++
+		}
+	}
+	if total > group.MaxTotalSize {
+		t.Errorf("Logs take up %d bytes, over the shared budget of %d", total, group.MaxTotalSize)
+	}
+
+	// Both of the current logs must survive
+	for _, lm := range []*LogManager{access, errorLog} {
+		if _, err := os.Stat(lm.CurrentFilename()); err != nil {
+			t.Error(err)
+		}
+	}
+	if accessLogs < 2 || errorLogs < 2 {
+		t.Errorf("Expected both managers to keep a backup, found %d access and %d error logs", accessLogs, errorLogs)
+	}
+
+	os.RemoveAll(access.options.Dir)
+}
+
+func TestSharedRetentionInFlight(t *testing.T) {
+	group := &RetentionGroup{MaxBackups: 1}
+	access := setup(LogManagerOptions{
+		FilenameFormat:  "access_{{ .Iteration }}.log",
+		GZIP:            true,
+		AsyncCompress:   true,
+		SharedRetention: group,
+	})
+	errorLog := NewLogManager(LogManagerOptions{
+		Dir:             access.options.Dir,
+		FilenameFormat:  "error_{{ .Iteration }}.log",
+		SharedRetention: group,
+	})
+
+	// Hold up compressing the first access log until the other manager's rotations have enforced the group
+	release := make(chan struct{})
+	first := access.CurrentFilename()
+	access.compressor = func(ctx context.Context, filename, dest string) error {
+		if filename == first {
+			<-release
+		}
+		return access.compress(ctx, filename, dest)
+	}
+	access.Write([]byte("test"))
+	err := access.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		errorLog.Write([]byte("test"))
+		err = errorLog.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The log that's still being compressed shouldn't be removed before its archive exists, whoever enforced the group
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("Log being compressed was removed by shared retention: %s", err)
+	}
+
+	close(release)
+	access.Close()
+	errorLog.Close()
+	os.RemoveAll(access.options.Dir)
+}
+
+func TestKeepFirstPerPeriod(t *testing.T) {
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.Local)
+	lm := setup(LogManagerOptions{
+		GZIP:               true,
+		KeepFirstPerPeriod: PeriodDay,
+		KeepAllFor:         24 * time.Hour,
+		Now:                func() time.Time { return now },
+	})
+
+	// A few logs a day, for three days
+	for _, at := range []time.Time{
+		time.Date(2022, 5, 17, 11, 0, 0, 0, time.Local),
+		time.Date(2022, 5, 17, 12, 0, 0, 0, time.Local),
+		time.Date(2022, 5, 18, 10, 0, 0, 0, time.Local),
+		time.Date(2022, 5, 18, 11, 0, 0, 0, time.Local),
+		time.Date(2022, 5, 19, 10, 0, 0, 0, time.Local),
+		time.Date(2022, 5, 19, 11, 0, 0, 0, time.Local),
+	} {
+		lm.Write([]byte("line\n"))
+		now = at
+		err := lm.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the first of each day should be left, except for the last day, which is all still kept
+	found, err := lm.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range found {
+		names = append(names, filepath.Base(b.path))
+	}
+	sort.Strings(names)
+	want := []string{"2022-05-17_0.tar.gz", "2022-05-18_0.tar.gz", "2022-05-19_0.tar.gz"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("Kept %v, expected %v", names, want)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
@@ -0,0 +1,194 @@
+package logmanager
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RotatingFileOptions are the settings for a RotatingFile
+type RotatingFileOptions struct {
+	MaxSize int64                             // How large the file can get before it's rotated (0 for no limit)
+	MaxAge  time.Duration                     // How long after it was opened the file is rotated (0 for no limit)
+	Rename  func(path string) (string, error) // Moves the file out of the way, returning where to (defaults to shifting)
+	Now     func() time.Time                  // The clock used for MaxAge (defaults to time.Now)
+	OnError func(err error)                   // Called if rotating fails during a Write, which carries on in the old file
+}
+
+// RotatingFile is a single log file at a fixed path, rotated by size and/or age by shifting it out of the way (or with
+// Rename), without any of LogManager's directory management. It's safe for concurrent use.
+type RotatingFile struct {
+	options   RotatingFileOptions
+	openFile  func(path string) (*os.File, error)
+	closeFile func(f *os.File) error
+	undo      func(path, rotated string) error // Puts the rotated file back if a new one can't be opened, if set
+
+	mu     sync.Mutex
+	path   string
+	f      *os.File // Nil if a rotation failed, until the next write reopens it
+	size   int64
+	opened time.Time
+	closed bool
+}
+
+var _ Rotator = (*RotatingFile)(nil)
+
+// OpenRotatingFile opens the file at path for appending, creating it if it doesn't exist
+func OpenRotatingFile(path string, options RotatingFileOptions) (*RotatingFile, error) {
+	rf := newRotatingFile(path, options)
+	err := rf.open()
+	if err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// newRotatingFile is a helper function that sets up a RotatingFile for path with the defaults filled in, without
+// opening anything yet
+func newRotatingFile(path string, options RotatingFileOptions) *RotatingFile {
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+
+	rf := &RotatingFile{
+		options: options,
+		openFile: func(path string) (*os.File, error) {
+			return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		},
+		closeFile: (*os.File).Close,
+		path:      path,
+	}
+	if options.Rename == nil {
+		rf.options.Rename = func(path string) (string, error) { return shift(path, "") }
+		rf.undo = func(path, rotated string) error { return unshift(path, rotated, "") }
+	}
+	return rf
+}
+
+// shifter is a helper function that wraps f, the current log file, in the RotatingFile that ShiftMode rotates it with.
+// The lock must already be held.
+func (lm *LogManager) shifter(f *os.File) *RotatingFile {
+	archiveDir := lm.options.ArchiveDir
+	rf := newRotatingFile(f.Name(), RotatingFileOptions{
+		Rename: func(path string) (string, error) { return shift(path, archiveDir) },
+	})
+	rf.undo = func(path, rotated string) error { return unshift(path, rotated, archiveDir) }
+	rf.openFile = lm.openWithRetries
+	rf.closeFile = lm.closeFile
+	rf.f = f
+	return rf
+}
+
+// open is a helper function that opens the file at rf's path, picking up its size. rf.mu must already be held
+// (or rf not shared yet).
+func (rf *RotatingFile) open() error {
+	f, err := rf.openFile(rf.path)
+	if err != nil {
+		return fmt.Errorf("unable to open log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to stat log file: %w", err)
+	}
+
+	rf.f, rf.size, rf.opened = f, fi.Size(), rf.options.Now()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if p would take it over MaxSize, or it's older than MaxAge
+func (rf *RotatingFile) Write(p []byte) (n int, err error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.closed {
+		return 0, os.ErrClosed
+	}
+
+	// A file that's still empty is never rotated, or big writes would leave a trail of empty files
+	if rf.f != nil {
+		full := rf.options.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.options.MaxSize
+		old := rf.options.MaxAge > 0 && rf.options.Now().Sub(rf.opened) >= rf.options.MaxAge
+		if full || old {
+			_, err = rf.rotate()
+			if err != nil && rf.options.OnError != nil {
+				rf.options.OnError(err)
+			}
+		}
+	}
+
+	// If a rotation failed, the old file is still at our path, so carry on in it
+	if rf.f == nil {
+		err = rf.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = rf.f.Write(p)
+	rf.size += int64(n)
+	return
+}
+
+// Rotate moves the file out of the way with Rename, and starts a new one at the same path
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.closed {
+		return os.ErrClosed
+	}
+	_, err := rf.rotate()
+	return err
+}
+
+// rotate is a helper function that does the work of Rotate, returning where the old file went ("" if it failed, in
+// which case the next write reopens it). rf.mu must already be held.
+func (rf *RotatingFile) rotate() (rotated string, err error) {
+	if rf.f != nil {
+		err = rf.closeFile(rf.f)
+		rf.f = nil
+		if err != nil {
+			return "", fmt.Errorf("unable to close log file: %w", err)
+		}
+	}
+
+	rotated, err = rf.options.Rename(rf.path)
+	if err != nil {
+		return "", fmt.Errorf("unable to rename log file: %w", err)
+	}
+
+	err = rf.open()
+	if err != nil {
+		if rf.undo != nil {
+			if undoErr := rf.undo(rf.path, rotated); undoErr != nil {
+				return "", fmt.Errorf("%w (and unable to put %s back: %s)", err, rf.path, undoErr)
+			}
+		}
+		return "", err
+	}
+	return rotated, nil
+}
+
+// CurrentFilename returns the path of the file being written to
+func (rf *RotatingFile) CurrentFilename() string {
+	return rf.path
+}
+
+// Close closes the file. Writing to it afterwards fails with os.ErrClosed.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.closed {
+		return nil
+	}
+	rf.closed = true
+	if rf.f == nil {
+		return nil
+	}
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
@@ -0,0 +1,138 @@
+package logmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	os.WriteFile(path, []byte("existing\n"), 0644)
+	rf, err := OpenRotatingFile(path, RotatingFileOptions{MaxSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The existing file should be carried on with, then shifted out of the way once it's full
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		_, err = rf.Write([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = rf.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf.Write([]byte("fourth\n"))
+
+	for name, want := range map[string]string{"app.log.2": "existing\nfirst\n", "app.log.1": "second\nthird\n", "app.log": "fourth\n"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, expected %q", name, b, want)
+		}
+	}
+
+	err = rf.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rf.Write([]byte("closed\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Writing after Close returned %v, expected os.ErrClosed", err)
+	}
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2022, 5, 17, 10, 0, 0, 0, time.UTC)
+	var renamed []string
+	rf, err := OpenRotatingFile(filepath.Join(dir, "app.log"), RotatingFileOptions{
+		MaxAge: time.Hour,
+		Now:    func() time.Time { return now },
+		Rename: func(path string) (string, error) {
+			dest := path + "." + now.Format("15")
+			renamed = append(renamed, filepath.Base(dest))
+			return dest, os.Rename(path, dest)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	rf.Write([]byte("ten\n"))
+	now = now.Add(59 * time.Minute)
+	rf.Write([]byte("still ten\n"))
+	now = now.Add(time.Minute)
+	rf.Write([]byte("eleven\n"))
+
+	if len(renamed) != 1 || renamed[0] != "app.log.11" {
+		t.Errorf("Renamed to %v, expected [app.log.11]", renamed)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "app.log.11"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "ten\nstill ten\n" {
+		t.Errorf("Rotated file contains %q", b)
+	}
+}
+
+func TestRotatingFileOpenFailure(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logmanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	rf, err := OpenRotatingFile(path, RotatingFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	rf.Write([]byte("first\n"))
+
+	// Fail to open the new file once, which should put the old one back for the next write
+	open := rf.openFile
+	rf.openFile = func(string) (*os.File, error) {
+		rf.openFile = open
+		return nil, os.ErrPermission
+	}
+	err = rf.Rotate()
+	if !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("Rotate returned %v, expected os.ErrPermission", err)
+	}
+	_, err = rf.Write([]byte("second\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first\nsecond\n" {
+		t.Errorf("%s contains %q", path, b)
+	}
+	if _, err := os.Stat(path + ".1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected %s.1 to have been put back, got %v", path, err)
+	}
+}
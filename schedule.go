@@ -0,0 +1,69 @@
+package logmanager
+
+import "time"
+
+// RotationSchedule rotates logs on calendar boundaries, which fixed intervals can't line up with (months and weeks across
+// DST changes aren't all the same length)
+type RotationSchedule int
+
+const (
+	// RotateNone doesn't rotate on a calendar schedule (default)
+	RotateNone RotationSchedule = iota
+	// RotateDaily rotates at midnight
+	RotateDaily
+	// RotateWeekly rotates at midnight on Mondays
+	RotateWeekly
+	// RotateMonthly rotates at midnight on the first of each month
+	RotateMonthly
+)
+
+// next returns the first boundary of the schedule after t, in t's location
+func (s RotationSchedule) next(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch s {
+	case RotateDaily:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+	case RotateWeekly:
+		// Days until next Monday, a whole week if it's Monday already
+		days := (8 - int(t.Weekday())) % 7
+		if days == 0 {
+			days = 7
+		}
+		return time.Date(year, month, day+days, 0, 0, 0, 0, t.Location())
+	case RotateMonthly:
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+	}
+
+	return time.Time{}
+}
+
+// Period is a calendar period, for thinning out old logs with KeepFirstPerPeriod
+type Period int
+
+const (
+	// PeriodNone doesn't thin out old logs (default)
+	PeriodNone Period = iota
+	// PeriodDay keeps the first log of each day
+	PeriodDay
+	// PeriodWeek keeps the first log of each week, starting on Monday
+	PeriodWeek
+	// PeriodMonth keeps the first log of each month
+	PeriodMonth
+)
+
+// start returns the start of the period t is in, in t's location
+func (p Period) start(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch p {
+	case PeriodDay:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case PeriodWeek:
+		// Days since Monday
+		days := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-days, 0, 0, 0, 0, t.Location())
+	case PeriodMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+
+	return time.Time{}
+}
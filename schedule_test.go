@@ -0,0 +1,61 @@
+package logmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotationScheduleNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("Time zone database isn't available")
+	}
+
+	for _, test := range []struct {
+		schedule RotationSchedule
+		from     time.Time
+		want     time.Time
+	}{
+		{RotateDaily, time.Date(2022, 5, 17, 12, 0, 0, 0, time.UTC), time.Date(2022, 5, 18, 0, 0, 0, 0, time.UTC)},
+		// Only 23 hours long, because of DST
+		{RotateDaily, time.Date(2022, 3, 13, 0, 0, 0, 0, ny), time.Date(2022, 3, 14, 0, 0, 0, 0, ny)},
+		{RotateWeekly, time.Date(2022, 5, 15, 12, 0, 0, 0, time.UTC), time.Date(2022, 5, 16, 0, 0, 0, 0, time.UTC)}, // Sunday
+		{RotateWeekly, time.Date(2022, 5, 16, 0, 0, 0, 0, time.UTC), time.Date(2022, 5, 23, 0, 0, 0, 0, time.UTC)},  // Monday
+		{RotateMonthly, time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC), time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{RotateMonthly, time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{RotateMonthly, time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		if got := test.schedule.next(test.from); !got.Equal(test.want) {
+			t.Errorf("Next boundary after %s is %s, expected %s", test.from, got, test.want)
+		}
+	}
+}
+
+func TestRotateMonthly(t *testing.T) {
+	now := time.Date(2022, 1, 31, 23, 59, 0, 0, time.UTC)
+	lm := setup(LogManagerOptions{
+		FilenameFormat:   `{{ .Time.Format "2006-01" }}.log`,
+		RotationSchedule: RotateMonthly,
+		Now:              func() time.Time { return now },
+	})
+
+	for _, step := range []struct {
+		now  time.Time
+		want string
+	}{
+		{time.Date(2022, 1, 31, 23, 59, 59, 0, time.UTC), "2022-01.log"},
+		{time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC), "2022-02.log"},
+		{time.Date(2022, 2, 28, 23, 59, 59, 0, time.UTC), "2022-02.log"},
+		{time.Date(2022, 3, 1, 0, 0, 1, 0, time.UTC), "2022-03.log"},
+	} {
+		now = step.now
+		lm.Write([]byte("test"))
+		if name := filepath.Base(lm.CurrentFilename()); name != step.want {
+			t.Errorf("Wrote to %s at %s, expected %s", name, now, step.want)
+		}
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
@@ -0,0 +1,107 @@
+package logmanager
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// sequenceFileName is the name of the file in the log directory that keeps the last sequence number between restarts
+const sequenceFileName = ".logmanager.seq"
+
+// nextSequence is a helper function that returns the prefix for the next write, with its sequence number
+func (lm *LogManager) nextSequence() []byte {
+	seq := atomic.AddUint64(&lm.sequence, 1)
+	return append(strconv.AppendUint(nil, seq, 10), ' ')
+}
+
+// loadSequence is a helper function that picks up the sequence numbers where the last run left off. A sequence file
+// that's empty or unreadable (e.g. after a crash) is left to recoverSequence.
+func (lm *LogManager) loadSequence() error {
+	b, err := os.ReadFile(filepath.Join(lm.options.Dir, sequenceFileName))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read sequence number: %w", err)
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		lm.logf("unable to parse sequence number, recovering it from the log instead: %s", err)
+		return nil
+	}
+	atomic.StoreUint64(&lm.sequence, seq)
+	return nil
+}
+
+// recoverSequence is a helper function that carries on numbering from the last numbered record near the end of the
+// log at path, if it's past the saved one (e.g. after a crash).
+func (lm *LogManager) recoverSequence(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to recover sequence number: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to recover sequence number: %w", err)
+	}
+
+	offset := info.Size() - sequenceTail
+	if offset < 0 {
+		offset = 0
+	}
+	b := make([]byte, info.Size()-offset)
+	_, err = f.ReadAt(b, offset)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("unable to recover sequence number: %w", err)
+	}
+
+	// Work back from the last line, past anything that isn't numbered (e.g. a header)
+	lines := strings.Split(string(b), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		prefix, _, found := strings.Cut(lines[i], " ")
+		if !found {
+			continue
+		}
+		if seq, err := strconv.ParseUint(prefix, 10, 64); err == nil {
+			if seq > atomic.LoadUint64(&lm.sequence) {
+				atomic.StoreUint64(&lm.sequence, seq)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// sequenceTail is how much of the end of a log recoverSequence looks through for the last numbered record
+const sequenceTail = 64 * 1024
+
+// saveSequence is a helper function that keeps the last sequence number used, so the next run can carry on from it.
+// It's written to a temp file first, then renamed into place, so a crash never leaves a partial one behind.
+func (lm *LogManager) saveSequence() error {
+	path := filepath.Join(lm.options.Dir, sequenceFileName)
+	seq := strconv.FormatUint(atomic.LoadUint64(&lm.sequence), 10)
+
+	tmp, err := os.CreateTemp(lm.options.Dir, lm.tempPattern(path))
+	if err != nil {
+		return fmt.Errorf("unable to save sequence number: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(seq + "\n")
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = replaceFile(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to save sequence number: %w", err)
+	}
+	return nil
+}
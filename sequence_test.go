@@ -0,0 +1,147 @@
+package logmanager
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readSequences is a helper function that reads the sequence number from every line in the given logs, in order
+func readSequences(t *testing.T, paths ...string) (seqs []uint64) {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			seq, err := strconv.ParseUint(strings.SplitN(scanner.Text(), " ", 2)[0], 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seqs = append(seqs, seq)
+		}
+		f.Close()
+	}
+	return
+}
+
+func TestSequenceNumbers(t *testing.T) {
+	options := LogManagerOptions{
+		FilenameFormat:  "seq_{{ .Iteration }}.log",
+		SequenceNumbers: true,
+	}
+	lm := setup(options)
+	options.Dir = lm.options.Dir
+
+	n, err := lm.Write([]byte("first\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len("first\n") {
+		t.Errorf("Write reported %d bytes, expected %d", n, len("first\n"))
+	}
+	lm.Write([]byte("second\n"))
+	lm.Rotate()
+	lm.Write([]byte("third\n"))
+
+	// Restart, and keep going
+	lm.Close()
+	lm = NewLogManager(options)
+	lm.Rotate()
+	lm.Write([]byte("fourth\n"))
+	lm.Close()
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		paths = append(paths, filepath.Join(options.Dir, "seq_"+strconv.Itoa(i)+".log"))
+	}
+	seqs := readSequences(t, paths...)
+	for i, seq := range seqs {
+		if seq != uint64(i+1) {
+			t.Errorf("Expected sequence numbers 1 to 4, found %v", seqs)
+			break
+		}
+	}
+	if len(seqs) != 4 {
+		t.Errorf("Expected 4 numbered lines, found %d", len(seqs))
+	}
+
+	os.RemoveAll(options.Dir)
+}
+
+func TestSequenceRecovery(t *testing.T) {
+	for name, contents := range map[string]string{
+		"empty":   "",
+		"corrupt": "4\x00\x00",
+	} {
+		t.Run(name, func(t *testing.T) {
+			options := LogManagerOptions{
+				FilenameFormat:  "seq_{{ .Iteration }}.log",
+				Header:          "header\n",
+				SequenceNumbers: true,
+			}
+			lm := setup(options)
+			options.Dir = lm.options.Dir
+			lm.Rotate()
+			for i := 0; i < 3; i++ {
+				lm.Write([]byte("line\n"))
+			}
+			lm.Close()
+
+			// A crash part way through saving it shouldn't stop the next run, or put the numbers back to the start
+			err := os.WriteFile(filepath.Join(options.Dir, sequenceFileName), []byte(contents), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lm = New(options)
+			err = lm.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			lm.Write([]byte("line\n"))
+			lm.Close()
+
+			b, err := os.ReadFile(filepath.Join(options.Dir, "seq_1.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(string(b), "3 line\n4 line\n") {
+				t.Errorf("Log contains %q, expected numbering to carry on from 3", b)
+			}
+
+			os.RemoveAll(options.Dir)
+		})
+	}
+}
+
+func TestSequenceCrash(t *testing.T) {
+	options := LogManagerOptions{
+		FilenameFormat:  "seq_{{ .Iteration }}.log",
+		SequenceNumbers: true,
+	}
+	lm := setup(options)
+	options.Dir = lm.options.Dir
+	lm.Write([]byte("a\n"))
+	lm.Rotate()
+	lm.Write([]byte("b\n"))
+	lm.Write([]byte("c\n"))
+
+	// Start again without closing, as if the process had crashed, so the sequence file is behind the log
+	lm = NewLogManager(options)
+	lm.Write([]byte("d\n"))
+	lm.Close()
+
+	b, err := os.ReadFile(filepath.Join(options.Dir, "seq_1.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "2 b\n3 c\n4 d\n" {
+		t.Errorf("Log contains %q, expected numbering to carry on from 3", b)
+	}
+
+	os.RemoveAll(options.Dir)
+}
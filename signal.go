@@ -0,0 +1,44 @@
+package logmanager
+
+import (
+	"os"
+	"os/signal"
+)
+
+// FlushOnSignal syncs the current log file to disk whenever one of the given signals is received, without rotating it,
+// until stop is called.
+func (lm *LogManager) FlushOnSignal(sig ...os.Signal) (stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+
+	stopFlushing := lm.flushOnSignals(c)
+	return func() {
+		signal.Stop(c)
+		stopFlushing()
+	}
+}
+
+// flushOnSignals syncs the current file every time a signal arrives on c, until the returned stop function is called
+func (lm *LogManager) flushOnSignals(c <-chan os.Signal) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-c:
+				err := lm.Sync()
+				if err != nil {
+					lm.logf("unable to flush log file on signal: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
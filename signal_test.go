@@ -0,0 +1,42 @@
+package logmanager
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFlushOnSignal(t *testing.T) {
+	lm := setup(LogManagerOptions{})
+	fs := &mockFS{}
+	lm.fs = fs
+
+	// Simulate the signal arriving, rather than actually sending one to the test process
+	c := make(chan os.Signal, 1)
+	stop := lm.flushOnSignals(c)
+	lm.Write([]byte("before shutdown"))
+	name := lm.CurrentFilename()
+	c <- os.Interrupt
+
+	for i := 0; i < 100 && len(lm.syncedFiles(fs)) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	stop()
+
+	synced := lm.syncedFiles(fs)
+	if len(synced) != 1 || synced[0] != name {
+		t.Errorf("Expected %s to be synced once, synced %v", name, synced)
+	}
+	if lm.CurrentFilename() != name {
+		t.Errorf("Flushing rotated the log file")
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+// syncedFiles reads the files synced through fs, under the lock so it doesn't race with the flushing goroutine
+func (lm *LogManager) syncedFiles(fs *mockFS) []string {
+	lm.Lock()
+	defer lm.Unlock()
+	return append([]string(nil), fs.synced...)
+}
@@ -0,0 +1,60 @@
+package logmanager
+
+import "fmt"
+
+// Rotatable is implemented by WriterFactory writers that can mark a rotation themselves, so that with ReuseWriter
+// they're kept open across rotations instead of being closed and opened again (e.g. a network connection)
+type Rotatable interface {
+	Rotate() error
+}
+
+// writeSink is a helper function that copies p, which has just been written to the current file, to its
+// WriterFactory writer, opening one first if there isn't one yet. The lock must already be held.
+func (lm *LogManager) writeSink(p []byte) (err error) {
+	if lm.sink == nil {
+		name := lm.currentFile.Name()
+		lm.hook(func() { lm.sink, err = lm.options.WriterFactory(name) })
+		if err != nil {
+			lm.sink = nil
+			return fmt.Errorf("unable to open writer: %w", err)
+		}
+	}
+
+	lm.hook(func() { _, err = lm.sink.Write(p) })
+	if err != nil {
+		return fmt.Errorf("unable to write to writer: %w", err)
+	}
+	return
+}
+
+// rotateSink is a helper function that calls Rotate on the WriterFactory writer with ReuseWriter, if it's Rotatable, or
+// closes it otherwise, for the next write to open a new one. The lock must already be held.
+func (lm *LogManager) rotateSink() {
+	if r, ok := lm.sink.(Rotatable); ok && lm.options.ReuseWriter {
+		var err error
+		lm.hook(func() { err = r.Rotate() })
+		if err == nil {
+			return
+		}
+		lm.logf("unable to rotate writer, reopening it: %s", err)
+	}
+
+	err := lm.closeSink()
+	if err != nil {
+		lm.logf("%s", err)
+	}
+}
+
+// closeSink is a helper function that closes the WriterFactory writer, if there is one. The lock must already be held.
+func (lm *LogManager) closeSink() (err error) {
+	if lm.sink == nil {
+		return
+	}
+	sink := lm.sink
+	lm.sink = nil
+	lm.hook(func() { err = sink.Close() })
+	if err != nil {
+		return fmt.Errorf("unable to close writer: %w", err)
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package logmanager
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+// mockSink is a WriterFactory writer that records what it's sent
+type mockSink struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (s *mockSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// rotatableSink is a mockSink that marks rotations itself
+type rotatableSink struct {
+	mockSink
+}
+
+func (s *rotatableSink) Rotate() error {
+	s.WriteString("--\n")
+	return nil
+}
+
+func TestWriterFactory(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		reuse     bool
+		rotatable bool
+		want      []string // What each writer that was opened should have gotten
+	}{
+		{"Reopened", false, true, []string{"first\n", "second\n"}},
+		{"Reused", true, true, []string{"first\n--\nsecond\n"}},
+		{"NotRotatable", true, false, []string{"first\n", "second\n"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var sinks []*mockSink
+			var names []string
+			lm := setup(LogManagerOptions{
+				ReuseWriter: test.reuse,
+				WriterFactory: func(filename string) (io.WriteCloser, error) {
+					names = append(names, filename)
+					if test.rotatable {
+						s := &rotatableSink{}
+						sinks = append(sinks, &s.mockSink)
+						return s, nil
+					}
+					s := &mockSink{}
+					sinks = append(sinks, s)
+					return s, nil
+				},
+			})
+			defer os.RemoveAll(lm.options.Dir)
+
+			lm.Write([]byte("first\n"))
+			first := lm.CurrentFilename()
+			err := lm.Rotate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			lm.Write([]byte("second\n"))
+			err = lm.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(sinks) != len(test.want) {
+				t.Fatalf("Opened %d writers, expected %d", len(sinks), len(test.want))
+			}
+			for i, s := range sinks {
+				if s.String() != test.want[i] {
+					t.Errorf("Writer %d got %q, expected %q", i, s.String(), test.want[i])
+				}
+				if !s.closed {
+					t.Errorf("Writer %d was never closed", i)
+				}
+			}
+			if names[0] != first {
+				t.Errorf("Writer was opened for %s, expected %s", names[0], first)
+			}
+		})
+	}
+}
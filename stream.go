@@ -0,0 +1,73 @@
+package logmanager
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// streaming is a helper function that checks if logs are being gzipped as they're written. A FIFO has no file to
+// compress, and shifted logs keep a fixed name, so StreamCompress doesn't apply to either.
+func (lm *LogManager) streaming() bool {
+	return lm.options.StreamCompress && !lm.options.FIFO && !lm.options.ShiftMode
+}
+
+// startStream is a helper function that starts a gzip stream (or a new member of one) in the current file, if we're
+// streaming. The lock must already be held.
+func (lm *LogManager) startStream() {
+	if lm.streaming() {
+		lm.stream = gzip.NewWriter(lm.currentFile)
+		lm.stream.Comment = lm.options.GZIPComment
+		lm.streamTail = 0
+	}
+}
+
+// writeFile is a helper function that writes p to the current file, through its gzip stream if it has one.
+// The lock must already be held.
+func (lm *LogManager) writeFile(p []byte) (n int, err error) {
+	if lm.stream == nil {
+		return lm.currentFile.Write(p)
+	}
+
+	n, err = lm.stream.Write(p)
+	if n > 0 {
+		lm.streamTail = p[n-1]
+	}
+	return
+}
+
+// streamTrailingNewline is a helper function that ends the current file's gzip stream with a newline, if the last
+// write to it since it was started didn't. The lock must already be held.
+func (lm *LogManager) streamTrailingNewline() error {
+	if lm.streamTail == 0 || lm.streamTail == '\n' {
+		return nil
+	}
+	_, err := lm.writeFile([]byte("\n"))
+	if err != nil {
+		return fmt.Errorf("unable to write trailing newline: %w", err)
+	}
+	return nil
+}
+
+// closeFile is a helper function that finishes the current file's gzip stream, if it has one, then closes f.
+// The lock must already be held.
+func (lm *LogManager) closeFile(f *os.File) error {
+	if lm.stream != nil {
+		err := lm.stream.Close()
+		lm.stream = nil
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// streamSize is a helper function that updates the current file's size after a write to its gzip stream, which only
+// adds as much to the file as it compressed down to. The lock must already be held.
+func (lm *LogManager) streamSize() {
+	if fi, err := lm.currentFile.Stat(); err == nil {
+		atomic.StoreInt64(&lm.stats.currentFileSize, fi.Size())
+	}
+}
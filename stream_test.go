@@ -0,0 +1,133 @@
+package logmanager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dirSize is a helper function that adds up the size of every file in dir
+func dirSize(t *testing.T, dir string) (size int64) {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestStreamCompress(t *testing.T) {
+	lm := setup(LogManagerOptions{
+		FilenameFormat: "{{ .Iteration }}.log",
+		StreamCompress: true,
+		GZIP:           true,
+		MaxFileSize:    4096,
+	})
+
+	// Nothing should ever be written uncompressed, even for a moment, so the directory only ever grows by what each
+	// write compressed down to
+	var want strings.Builder
+	var peak, plain int64
+	for i := 0; i < 5000; i++ {
+		line := fmt.Sprintf("%04d request %08x took %dms\n", i, uint32(i)*2654435761, i%997)
+		want.WriteString(line)
+		plain += int64(len(line))
+		_, err := lm.Write([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := dirSize(t, lm.options.Dir); size > peak {
+			peak = size
+		}
+	}
+	if lm.Stats().Rotations < 3 {
+		t.Errorf("Only rotated %d times, compressed size wasn't what was counted", lm.Stats().Rotations)
+	}
+	lm.Close()
+
+	final := dirSize(t, lm.options.Dir)
+	if peak > final || final > plain/2 {
+		t.Errorf("Disk usage peaked at %d bytes, for %d bytes compressed into %d", peak, plain, final)
+	}
+
+	// Every log should be a gzip file, and between them, hold every line in order
+	entries, err := os.ReadDir(lm.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".log.gz") {
+			t.Errorf("%s isn't a compressed log", entry.Name())
+		}
+	}
+	r, err := lm.OpenHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want.String() {
+		t.Errorf("Logs contain %d bytes once decompressed, expected %d", len(b), want.Len())
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+// gunzip is a helper function that decompresses as much of b as has been flushed. A stream that's still being written
+// hasn't been finished yet, so it's expected to end early.
+func gunzip(t *testing.T, b []byte) string {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestStreamCompressSnapshot(t *testing.T) {
+	lm := setup(LogManagerOptions{StreamCompress: true, GZIP: true})
+	content := strings.Repeat("streamed line\n", 1000)
+	lm.Write([]byte(content))
+
+	// Both should see everything written so far, not just what the stream happened to have compressed
+	dest := filepath.Join(lm.options.Dir, "snapshot.bak")
+	err := lm.Snapshot(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzip(t, b); got != content {
+		t.Errorf("Snapshot decompresses to %d bytes, expected %d", len(got), len(content))
+	}
+
+	var buf bytes.Buffer
+	_, err = lm.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzip(t, buf.Bytes()); got != content {
+		t.Errorf("WriteTo decompresses to %d bytes, expected %d", len(got), len(content))
+	}
+
+	lm.Close()
+	os.RemoveAll(lm.options.Dir)
+}
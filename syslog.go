@@ -0,0 +1,122 @@
+package logmanager
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// SyslogConfig is where, and how, writes are copied to syslog as well as the log file
+type SyslogConfig struct {
+	Network   string        // The network to dial, e.g. "udp", "tcp", or "unixgram" (empty for the local syslog daemon)
+	Address   string        // The address to dial (empty for the local syslog daemon)
+	Tag       string        // The tag on each message (defaults to the program's name)
+	Priority  int           // The facility and severity of each message, as in log/syslog (defaults to LOG_USER|LOG_INFO)
+	QueueSize int           // How many writes can wait to be sent before they're dropped (defaults to 1000)
+	Timeout   time.Duration // How long dialing or sending can take, and Close waits for the queue (defaults to 5 seconds)
+}
+
+// syslogRedial is how long to wait before dialing syslog again after it fails
+const syslogRedial = time.Second
+
+// syslogTee copies writes to syslog from a goroutine of its own, so a slow or missing syslog never holds up the log file
+type syslogTee struct {
+	writes  chan []byte
+	done    chan struct{}
+	abandon chan struct{} // Closed once Close has waited long enough, so the rest of the queue is dropped
+	timeout time.Duration
+	once    sync.Once
+}
+
+// startSyslog is a helper function that starts copying writes to the syslog described by config
+func startSyslog(config SyslogConfig, logger *log.Logger) *syslogTee {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	st := &syslogTee{
+		writes:  make(chan []byte, config.QueueSize),
+		done:    make(chan struct{}),
+		abandon: make(chan struct{}),
+		timeout: config.Timeout,
+	}
+
+	logf := func(format string, v ...any) {
+		if logger != nil {
+			logger.Printf(format, v...)
+		}
+	}
+
+	go func() {
+		defer close(st.done)
+		var w io.WriteCloser
+		var failed time.Time
+		for p := range st.writes {
+			select {
+			case <-st.abandon:
+				continue
+			default:
+			}
+
+			// Drop writes while syslog is down, rather than dialing for every one of them
+			if w == nil {
+				if !failed.IsZero() && time.Since(failed) < syslogRedial {
+					continue
+				}
+				var err error
+				w, err = dialSyslog(config)
+				if err != nil {
+					logf("unable to connect to syslog: %s", err)
+					failed = time.Now()
+					continue
+				}
+				failed = time.Time{}
+			}
+
+			_, err := w.Write(p)
+			if err != nil {
+				logf("unable to write to syslog: %s", err)
+				w.Close()
+				w = nil
+				failed = time.Now()
+			}
+		}
+		if w != nil {
+			w.Close()
+		}
+	}()
+
+	return st
+}
+
+// sameSyslog is a helper function that checks if a and b send to the same syslog, the same way
+func sameSyslog(a, b *SyslogConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// tee is a helper function that queues a copy of p to be sent to syslog, dropping it if the queue is full
+func (st *syslogTee) tee(p []byte) {
+	select {
+	case st.writes <- append([]byte(nil), p...):
+	default:
+	}
+}
+
+// stop is a helper function that sends what's still queued to syslog, then disconnects. If that takes longer than the
+// timeout, the rest is dropped, and it only waits for the message being sent (which has a deadline of its own).
+func (st *syslogTee) stop() {
+	st.once.Do(func() { close(st.writes) })
+
+	select {
+	case <-st.done:
+	case <-time.After(st.timeout):
+		close(st.abandon)
+		<-st.done
+	}
+}
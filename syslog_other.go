@@ -0,0 +1,13 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package logmanager
+
+import (
+	"errors"
+	"io"
+)
+
+// dialSyslog connects to the syslog described by config
+func dialSyslog(config SyslogConfig) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,90 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package logmanager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// syslogConn is a connection to syslog that, unlike log/syslog's, gives up on dialing or writing after a timeout
+type syslogConn struct {
+	conn     net.Conn
+	local    bool // The local daemon doesn't expect a hostname
+	hostname string
+	tag      string
+	priority syslog.Priority
+	timeout  time.Duration
+}
+
+// dialSyslog connects to the syslog described by config
+func dialSyslog(config SyslogConfig) (io.WriteCloser, error) {
+	w := &syslogConn{tag: config.Tag, priority: syslog.Priority(config.Priority), timeout: config.Timeout}
+	if w.priority == 0 {
+		w.priority = syslog.LOG_USER | syslog.LOG_INFO
+	}
+	if w.tag == "" {
+		w.tag = os.Args[0]
+	}
+
+	if config.Network == "" {
+		w.local = true
+		for _, network := range []string{"unixgram", "unix"} {
+			for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+				conn, err := net.DialTimeout(network, path, w.timeout)
+				if err == nil {
+					w.conn = conn
+					return w, nil
+				}
+			}
+		}
+		return nil, errors.New("unable to find the local syslog daemon")
+	}
+
+	conn, err := net.DialTimeout(config.Network, config.Address, w.timeout)
+	if err != nil {
+		return nil, err
+	}
+	w.conn = conn
+	w.hostname, _ = os.Hostname()
+	if w.hostname == "" {
+		w.hostname = conn.LocalAddr().String()
+	}
+	return w, nil
+}
+
+// Write sends p to syslog as one message, in the same format log/syslog does
+func (w *syslogConn) Write(p []byte) (n int, err error) {
+	nl := ""
+	if !strings.HasSuffix(string(p), "\n") {
+		nl = "\n"
+	}
+
+	var msg string
+	if w.local {
+		msg = fmt.Sprintf("<%d>%s %s[%d]: %s%s", w.priority, time.Now().Format(time.Stamp), w.tag, os.Getpid(), p, nl)
+	} else {
+		msg = fmt.Sprintf("<%d>%s %s %s[%d]: %s%s", w.priority, time.Now().Format(time.RFC3339), w.hostname, w.tag, os.Getpid(), p, nl)
+	}
+
+	err = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	if err != nil {
+		return
+	}
+	_, err = io.WriteString(w.conn, msg)
+	if err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+// Close disconnects from syslog
+func (w *syslogConn) Close() error {
+	return w.conn.Close()
+}
@@ -0,0 +1,131 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package logmanager
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslog(t *testing.T) {
+	// A fake syslog daemon, listening on a socket of its own
+	sockDir, err := os.MkdirTemp("", "syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sockDir)
+	sock := filepath.Join(sockDir, "log.sock")
+	conn, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Skip("Platform doesn't support unixgram sockets:", err)
+	}
+	defer conn.Close()
+
+	lm := setup(LogManagerOptions{
+		Syslog: &SyslogConfig{Network: "unixgram", Address: sock, Tag: "app"},
+	})
+	for _, line := range []string{"first\n", "second\n"} {
+		_, err = lm.Write([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, 1024)
+	for _, line := range []string{"first", "second"} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Syslog didn't get %q: %s", line, err)
+		}
+		msg := string(buf[:n])
+		if !strings.Contains(msg, "app[") || !strings.HasSuffix(msg, line+"\n") {
+			t.Errorf("Syslog got %q, expected a message tagged app containing %q", msg, line)
+		}
+	}
+
+	name := lm.CurrentFilename()
+	lm.Close()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first\nsecond\n" {
+		t.Errorf("Log file contains %q, expected both writes", b)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestSyslogUnavailable(t *testing.T) {
+	// Nothing is listening, so every write to syslog fails; the file shouldn't notice
+	lm := setup(LogManagerOptions{
+		Syslog: &SyslogConfig{Network: "unixgram", Address: filepath.Join(os.TempDir(), "logmanager_missing.sock")},
+	})
+	for i := 0; i < 10; i++ {
+		_, err := lm.Write([]byte("line\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	name := lm.CurrentFilename()
+	err := lm.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != strings.Repeat("line\n", 10) {
+		t.Errorf("Log file contains %q, expected every write", b)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
+
+func TestSyslogStuck(t *testing.T) {
+	// A syslog that accepts the connection, but never reads anything from it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("Unable to listen on loopback:", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	lm := setup(LogManagerOptions{
+		Syslog: &SyslogConfig{Network: "tcp", Address: listener.Addr().String(), Timeout: 100 * time.Millisecond},
+	})
+	line := strings.Repeat("x", 64*1024) + "\n"
+	for i := 0; i < 200; i++ {
+		_, err := lm.Write([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Close shouldn't wait on syslog for longer than its timeout (plus the message it's stuck sending)
+	start := time.Now()
+	err = lm.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %s waiting on syslog", elapsed)
+	}
+
+	os.RemoveAll(lm.options.Dir)
+}
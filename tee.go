@@ -0,0 +1,58 @@
+package logmanager
+
+import (
+	"fmt"
+	"io"
+)
+
+// TeeErrorPolicy controls what happens when one of the Tee writers fails
+type TeeErrorPolicy int
+
+const (
+	// TeeIgnore reports the error to the logger, and carries on writing to it (default)
+	TeeIgnore TeeErrorPolicy = iota
+	// TeeFail returns the error from Write, even though the log file was written to
+	TeeFail
+	// TeeRemove reports the error to the logger, and stops writing to it
+	TeeRemove
+)
+
+// tee is a helper function that copies p, which has just been written to the current file, to each of the Tee writers.
+// The lock must already be held.
+func (lm *LogManager) tee(p []byte) (err error) {
+	kept := lm.tees[:0]
+	for _, w := range lm.tees {
+		var teeErr error
+		lm.hook(func() { _, teeErr = w.Write(p) })
+		if teeErr == nil {
+			kept = append(kept, w)
+			continue
+		}
+
+		switch lm.options.TeeErrorPolicy {
+		case TeeFail:
+			kept = append(kept, w)
+			if err == nil {
+				err = fmt.Errorf("unable to write to tee: %w", teeErr)
+			}
+		case TeeRemove:
+			lm.logf("unable to write to tee, removing it: %s", teeErr)
+		default:
+			kept = append(kept, w)
+			lm.logf("unable to write to tee: %s", teeErr)
+		}
+	}
+
+	// Don't hang on to anything we've removed
+	for i := len(kept); i < len(lm.tees); i++ {
+		lm.tees[i] = nil
+	}
+	lm.tees = kept
+	return
+}
+
+// setTees is a helper function that starts copying writes to the given Tee writers, instead of the ones before.
+// The lock must already be held.
+func (lm *LogManager) setTees(tees []io.Writer) {
+	lm.tees = append([]io.Writer(nil), tees...)
+}
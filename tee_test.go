@@ -0,0 +1,66 @@
+package logmanager
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// failingWriter is a tee writer that fails every write
+type failingWriter struct {
+	writes int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	f.writes++
+	return 0, errors.New("sink is closed")
+}
+
+func TestTee(t *testing.T) {
+	for _, test := range []struct {
+		policy      TeeErrorPolicy
+		fail        bool // Whether Write should fail
+		keepsTrying bool // Whether the failing writer should still be written to
+	}{
+		{TeeIgnore, false, true},
+		{TeeFail, true, true},
+		{TeeRemove, false, false},
+	} {
+		var good bytes.Buffer
+		bad := &failingWriter{}
+		var logged strings.Builder
+		lm := setup(LogManagerOptions{
+			Tee:            []io.Writer{bad, &good},
+			TeeErrorPolicy: test.policy,
+			Logger:         log.New(&logged, "", 0),
+		})
+
+		for _, line := range []string{"one\n", "two\n"} {
+			_, err := lm.Write([]byte(line))
+			if (err != nil) != test.fail {
+				t.Errorf("Policy %d: Write returned %v", test.policy, err)
+			}
+		}
+
+		// The log file, and the writers that work, should get everything regardless
+		b, err := os.ReadFile(lm.CurrentFilename())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "one\ntwo\n" || good.String() != "one\ntwo\n" {
+			t.Errorf("Policy %d: log file got %q, and working tee got %q", test.policy, b, good.String())
+		}
+		if wantWrites := map[bool]int{true: 2, false: 1}[test.keepsTrying]; bad.writes != wantWrites {
+			t.Errorf("Policy %d: failing tee was written to %d times, expected %d", test.policy, bad.writes, wantWrites)
+		}
+		if !test.fail && !strings.Contains(logged.String(), "sink is closed") {
+			t.Errorf("Policy %d: tee error wasn't logged", test.policy)
+		}
+
+		os.RemoveAll(lm.options.Dir)
+	}
+}
@@ -0,0 +1,73 @@
+package logmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// upload is a helper function that starts uploading the archive at archiveFn with UploadArchive in the background,
+// removing it afterwards if DeleteAfterUpload is set. Failed uploads are reported to the logger, and the archive is kept.
+func (lm *LogManager) upload(archiveFn string) {
+	upload, remove, logger := lm.options.UploadArchive, lm.options.DeleteAfterUpload, lm.options.Logger
+	if upload == nil {
+		return
+	}
+	logf := func(format string, v ...any) {
+		if logger != nil {
+			logger.Printf(format, v...)
+		}
+	}
+
+	// Name it the same way it's laid out locally
+	dir := lm.options.Dir
+	if lm.options.ArchiveDir != "" {
+		dir = lm.options.ArchiveDir
+	}
+	name, err := filepath.Rel(dir, archiveFn)
+	if err != nil {
+		name = filepath.Base(archiveFn)
+	}
+	name = filepath.ToSlash(name)
+
+	// Open it straight away, in case it's shifted along or removed while our turn is coming up
+	f, err := os.Open(archiveFn)
+	if err != nil {
+		logf("unable to upload %s: %s", archiveFn, err)
+		return
+	}
+
+	lm.workers.Add(1)
+	go func() {
+		defer lm.workers.Done()
+		defer f.Close()
+
+		err := upload(context.Background(), name, f)
+		if err != nil {
+			logf("unable to upload %s: %s", archiveFn, err)
+			return
+		}
+		if !remove {
+			return
+		}
+
+		// Only remove the archive if it's still the one we uploaded
+		uploaded, err := f.Stat()
+		if err != nil {
+			logf("unable to remove uploaded archive: %s", err)
+			return
+		}
+		if current, err := os.Stat(archiveFn); err != nil || !os.SameFile(uploaded, current) {
+			return
+		}
+		err = os.Remove(archiveFn)
+		if err != nil {
+			logf("unable to remove uploaded archive: %s", err)
+			return
+		}
+		err = removeArchiveMeta(archiveFn)
+		if err != nil {
+			logf("%s", err)
+		}
+	}()
+}